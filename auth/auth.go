@@ -56,3 +56,31 @@ func PinAuthMiddleware(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// CurrentUser returns the logged in user's name, from PinAuthMiddleware or
+// the X-PIN header; empty when neither identifies anyone
+func CurrentUser(c *fiber.Ctx) string {
+	if user, ok := c.Locals("user").(string); ok && user != "" {
+		return user
+	}
+	if pin := c.Get("X-PIN"); pin != "" {
+		if user, ok := checkUser(pin); ok {
+			return user
+		}
+	}
+	return ""
+}
+
+// IsAdmin reports whether the current user is listed in ADMIN_USERS
+// (comma separated user names, as in USER_PINS)
+func IsAdmin(c *fiber.Ctx) bool {
+	user := CurrentUser(c)
+	if user == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+		if strings.TrimSpace(admin) == user {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// CheckSecret makes sure APP_SECRET is set; without it anyone could make
+// ID card and calendar tokens, so the endpoints using them answer 503
+// until it is
+func CheckSecret() error {
+	if os.Getenv("APP_SECRET") == "" {
+		return errors.New("APP_SECRET is not set")
+	}
+	return nil
+}
+
+func secret() []byte {
+	return []byte(os.Getenv("APP_SECRET"))
+}
+
+// Sign returns a short url-safe signature of payload
+func Sign(payload string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Verify checks a signature made by Sign
+func Verify(payload, signature string) bool {
+	if len(secret()) == 0 {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(payload)), []byte(signature))
+}
+
+// SignedToken joins payload and its signature as "payload.signature"
+func SignedToken(payload string) string {
+	return payload + "." + Sign(payload)
+}
+
+// ParseToken returns the payload of a token made by SignedToken
+func ParseToken(token string) (string, bool) {
+	i := strings.LastIndex(token, ".")
+	if i <= 0 {
+		return "", false
+	}
+	payload, signature := token[:i], token[i+1:]
+	if !Verify(payload, signature) {
+		return "", false
+	}
+	return payload, true
+}
@@ -18,11 +18,22 @@ func main() {
 		log.Println("⚠️ .env file not found, continuing with environment variables")
 	}
 
+	// ID cards and calendar feeds are signed with APP_SECRET; they answer
+	// 503 until it is set
+	if err := auth.CheckSecret(); err != nil {
+		log.Println("⚠️", err, "- ID cards and calendar feeds are disabled")
+	}
+
 	// Connect to MongoDB
 	if err := database.ConnectDB(); err != nil {
 		log.Fatal("❌ Failed to connect to MongoDB:", err)
 	}
 
+	routes.EnsureIndexes()
+
+	// Students from before enrolments get one for their batch
+	routes.MigrateEnrolments()
+
 	// Get PORT from env (Render provides $PORT)
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -49,7 +60,21 @@ func main() {
     // students related routes
 	app.Get("/students", routes.GetStudents)
     app.Get("/student/:id", routes.GetStudentByID)
+    app.Get("/student/:id/progress", routes.GetStudentProgress)
+    app.Get("/student/:id/progress/export", routes.ExportStudentProgress)
+    app.Get("/student/:id/id-card", routes.StudentIDCard)
+    app.Get("/student/:id/fee", routes.GetStudentFee)
+    app.Get("/student/:id/balance", routes.GetStudentBalance)
+    app.Post("/student/:id/discounts", routes.GiveDiscount)
+    app.Delete("/student/:id/discounts/:ruleId", routes.RemoveDiscount)
+    app.Get("/student/:id/enrolments", routes.GetStudentEnrolments)
+    app.Post("/student/:id/enrolments", routes.AddEnrolment)
+    app.Patch("/api/enrolments/:id/fee", routes.UpdateEnrolmentFee)
+    app.Patch("/api/enrolments/:id/end", routes.EndEnrolment)
+    app.Post("/api/enrolments/:id/transfer", routes.TransferEnrolment)
+    app.Post("/api/enrolments/:id/pay", routes.PayEnrolment)
 	app.Post("/students/new", routes.AddStudent)
+	app.Post("/students/import", routes.ImportStudents)
 	app.Delete("/students/delete/:id", routes.DeleteStudent)
 	app.Patch("/students/edit/:id", routes.UpdateStudent)
 	app.Patch("/students/payment/:id", routes.TogglePaymentStatus)
@@ -60,9 +85,119 @@ func main() {
     app.Post("/api/batch/new", routes.AddBatch)
     app.Get("/api/batches", routes.GetAllBatch)
     app.Delete("/api/batch/:id", routes.DeleteBatch)
+    app.Get("/api/batch/:id/id-cards", routes.BatchIDCards)
+    app.Get("/api/batch/:id/report-cards", routes.BatchReportCardsZip)
+    app.Patch("/api/batch/:id/schedule", routes.UpdateBatchSchedule)
+    app.Patch("/api/batch/:id/teachers", routes.AssignTeachers)
+    app.Get("/api/timetable", routes.GetTimetable)
+
+    // staff related routes
+    app.Get("/api/staff", routes.GetStaff)
+    app.Post("/api/staff", routes.AddStaff)
+    app.Get("/api/staff/:id", routes.GetStaffByID)
+    app.Patch("/api/staff/:id", routes.UpdateStaff)
+    app.Delete("/api/staff/:id", routes.DeleteStaff)
+    app.Get("/api/staff/:id/batches", routes.GetTeacherBatches)
+    app.Get("/api/staff/:id/students", routes.GetTeacherStudents)
+
+    // payroll related routes
+    app.Get("/api/staff/:id/pay-rules", routes.GetPayRules)
+    app.Post("/api/staff/:id/pay-rules", routes.AddPayRule)
+    app.Delete("/api/pay-rules/:id", routes.DeletePayRule)
+    app.Post("/api/payroll/run", routes.RunPayroll)
+    app.Get("/api/payroll", routes.GetPayslips)
+    app.Get("/api/payroll/export", routes.ExportPayslips)
+    app.Get("/api/payslips/:id/pdf", routes.PayslipPDF)
+    app.Patch("/api/payslips/:id/pay", routes.PayPayslip)
+
+    // expense related routes
+    app.Get("/api/expenses", routes.GetExpenses)
+    app.Post("/api/expenses", routes.AddExpense)
+    app.Patch("/api/expenses/:id", routes.UpdateExpense)
+    app.Delete("/api/expenses/:id", routes.DeleteExpense)
+    app.Post("/api/expenses/:id/attachments", routes.AddExpenseAttachments)
+    app.Get("/api/expenses/:id/attachments/:fileId", routes.GetExpenseAttachment)
+
+    // report routes
+    app.Get("/api/reports/profit-loss", routes.GetProfitLoss)
+    app.Get("/api/reports/profit-loss/export", routes.ExportProfitLoss)
+    app.Get("/api/reports/collections", routes.GetCollectionsDashboard)
+    app.Get("/api/reports/cash-book", routes.GetCashBook)
+    app.Get("/api/reports/collections-by-method", routes.GetCollectionsByMethod)
+
+    // day close routes
+    app.Get("/api/day-close", routes.GetDayClose)
+    app.Post("/api/day-close", routes.CloseDay)
+    app.Delete("/api/day-close/:date", routes.ReopenDay)
+    app.Get("/api/day-closes", routes.GetDayCloses)
 
+    // payment ledger routes
+    app.Get("/api/payments", routes.GetPayments)
+    app.Get("/api/payments/:id/receipt", routes.PaymentReceiptPDF)
+    app.Get("/api/refunds", routes.GetRefunds)
+    app.Post("/api/refunds", routes.RequestRefund)
+    app.Patch("/api/refunds/:id/approve", routes.ApproveRefund)
+    app.Patch("/api/refunds/:id/reject", routes.RejectRefund)
+
+    // wallet statement reconciliation routes
+    app.Get("/api/statements", routes.GetStatements)
+    app.Post("/api/statements", routes.UploadStatement)
+    app.Get("/api/statements/:id", routes.GetStatementReconciliation)
+    app.Post("/api/statements/:id/lines/:row/payment", routes.PayFromStatementLine)
+
+    // invoice routes
+    app.Get("/api/invoices", routes.GetInvoices)
+    app.Post("/api/invoices/generate", routes.GenerateInvoices)
+    app.Patch("/api/invoices/:id/issue", routes.IssueInvoice)
+    app.Patch("/api/invoices/:id/void", routes.VoidInvoice)
+    app.Get("/api/invoices/:id/pdf", routes.InvoicePDF)
+
+    // discount related routes
+    app.Get("/api/discounts", routes.GetDiscountRules)
+    app.Post("/api/discounts", routes.AddDiscountRule)
+    app.Delete("/api/discounts/:id", routes.DeleteDiscountRule)
+
+    // late fee related routes
+    app.Get("/api/late-fee-policies", routes.GetLateFeePolicies)
+    app.Post("/api/late-fee-policies", routes.AddLateFeePolicy)
+    app.Delete("/api/late-fee-policies/:id", routes.DeleteLateFeePolicy)
+    app.Get("/api/late-fees", routes.GetLateFees)
+    app.Post("/api/late-fees/apply", routes.ApplyLateFees)
+    app.Patch("/api/late-fees/:id/waive", routes.WaiveLateFee)
+
+    // study day patterns (smw, stt, regular, ...)
+    app.Get("/api/study-days", routes.GetStudyDays)
+    app.Post("/api/study-days", routes.AddStudyDays)
+    app.Patch("/api/study-days/:code", routes.UpdateStudyDays)
+    app.Delete("/api/study-days/:code", routes.DeleteStudyDays)
+
+    // holidays and cancelled classes
+    app.Get("/api/holidays", routes.GetHolidays)
+    app.Post("/api/holidays", routes.AddHoliday)
+    app.Patch("/api/holidays/:id/make-up", routes.SetMakeUpClass)
+    app.Delete("/api/holidays/:id", routes.DeleteHoliday)
+
+    // calendar feeds (.ics)
+    app.Get("/api/calendar/link", routes.GetCalendarLink)
+    app.Get("/calendar/:kind/:id/:token", routes.CalendarFeed)
+
+    // attendance related routes
+    app.Post("/api/attendance/open", routes.OpenAttendance)
+    app.Post("/api/attendance/check-in", routes.CheckIn)
+    app.Get("/api/attendance/student/:id", routes.GetStudentAttendance)
+    app.Get("/api/attendance/batch/:id", routes.GetBatchAttendance)
+    app.Get("/api/attendance/:id", routes.GetAttendanceSession)
+    app.Patch("/api/attendance/:id/mark", routes.MarkAttendance)
 
     app.Post("/api/submit-results", routes.SubmitResults)
+    app.Get("/api/exams", routes.GetExams)
+    app.Post("/api/exams/import", routes.ImportMarks)
+    app.Get("/api/exams/:id/results-sheet", routes.ResultsSheetPDF)
+    app.Get("/api/exams/:id/report-cards", routes.ReportCardsZip)
+    app.Get("/api/exams/:id/report-card/:studentId", routes.ReportCardPDF)
+
+	// Charge late fees for overdue months in the background
+	go routes.RunLateFees()
 
 	// Start server
 	log.Println("🚀 Server starting on port " + port)
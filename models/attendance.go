@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attendance statuses. A record stays empty until it is marked.
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+)
+
+type AttendanceRecord struct {
+	StudentID string `bson:"student_id" json:"student_id"`
+	Name      string `bson:"name" json:"name"`
+	Status    string `bson:"status" json:"status"`
+}
+
+// AttendanceSession is one class of a batch on a given day
+type AttendanceSession struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	BatchID   string             `bson:"batch_id" json:"batch_id"`
+	Date      string             `bson:"date" json:"date"` // 2006-01-02
+	Records   []AttendanceRecord `bson:"records" json:"records"`
+	Override  bool               `bson:"override" json:"override"`
+	Closed    bool               `bson:"closed" json:"closed"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
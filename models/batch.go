@@ -11,4 +11,17 @@ type Batch struct {
     Subject       string             `bson:"subject" json:"subject"`
     TotalStudents int                `bson:"total_students" json:"total_students"`
     Payment_amount float64            `bson:"payment_amount" json:"payment_amount"`
+    // when set, Days and Time are filled in from it
+    Schedule      *Schedule          `bson:"schedule,omitempty" json:"schedule,omitempty"`
+    // IDs of the Staff teaching this batch
+    TeacherIDs    []string           `bson:"teacher_ids" json:"teacher_ids"`
+}
+
+// Schedule is when and where a batch meets every week
+type Schedule struct {
+    Weekdays []string `bson:"weekdays" json:"weekdays"` // "Saturday", "Monday", ...
+    Start    string   `bson:"start" json:"start"`       // 24h "16:00"
+    End      string   `bson:"end" json:"end"`
+    Room     string   `bson:"room,omitempty" json:"room,omitempty"`
+    Teacher  string   `bson:"teacher,omitempty" json:"teacher,omitempty"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MethodTotal is what came in through one payment method
+type MethodTotal struct {
+	Method     string           `bson:"method" json:"method"`
+	Name       string           `bson:"name" json:"name"`
+	Count      int              `bson:"count" json:"count"`
+	Amount     float64          `bson:"amount" json:"amount"`
+	Collectors []CollectorTotal `bson:"collectors" json:"collectors"`
+}
+
+// CollectorTotal is what one person at the counter took
+type CollectorTotal struct {
+	CollectedBy string  `bson:"collected_by" json:"collected_by"`
+	Count       int     `bson:"count" json:"count"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// DayClose is the front desk handing over a day's cash. Once a day is
+// closed only an admin can add or void payments made on it.
+type DayClose struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Date         string             `bson:"date" json:"date"` // 2006-01-02, one per day
+	Methods      []MethodTotal      `bson:"methods" json:"methods"`
+	Collectors   []CollectorTotal   `bson:"collectors" json:"collectors"` // all methods together
+	Count        int                `bson:"count" json:"count"`
+	Total        float64            `bson:"total" json:"total"`
+	CashIn       float64            `bson:"cash_in" json:"cash_in"`
+	CashRefunded float64            `bson:"cash_refunded" json:"cash_refunded"`
+	ExpectedCash float64            `bson:"expected_cash" json:"expected_cash"`
+	DeclaredCash float64            `bson:"declared_cash" json:"declared_cash"`
+	Variance     float64            `bson:"variance" json:"variance"` // declared less expected, negative when short
+	Note         string             `bson:"note,omitempty" json:"note,omitempty"`
+	ClosedBy     string             `bson:"closed_by,omitempty" json:"closed_by,omitempty"`
+	ClosedAt     *time.Time         `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	AmendedAt    *time.Time         `bson:"amended_at,omitempty" json:"amended_at,omitempty"` // last time an admin changed the day's payments after the close
+}
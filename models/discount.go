@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of discount
+const (
+	DiscountPercent = "percent" // Value percent of the base fee
+	DiscountFixed   = "fixed"   // Value taka off the base fee
+)
+
+// DiscountRule is a named concession such as a scholarship or a sibling
+// discount, given to students with a StudentDiscount
+type DiscountRule struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Value     float64            `bson:"value" json:"value"`
+	Note      string             `bson:"note" json:"note"`
+	Active    bool               `bson:"active" json:"active"`
+	Until     string             `bson:"until,omitempty" json:"until,omitempty"` // 2006-01, last month given once retired
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// StudentDiscount gives a student a rule for the months From to To
+// (2006-01, inclusive; empty means open-ended)
+type StudentDiscount struct {
+	RuleID     string    `bson:"rule_id" json:"rule_id"`
+	From       string    `bson:"from" json:"from"`
+	To         string    `bson:"to" json:"to"`
+	ApprovedBy string    `bson:"approved_by" json:"approved_by"`
+	Note       string    `bson:"note" json:"note"`
+	AddedAt    time.Time `bson:"added_at" json:"added_at"`
+}
+
+// Fee is how a student's monthly fee is made up; it is worked out on
+// request and never stored. A student's fee is the sum of the Parts, one
+// per enrolment.
+type Fee struct {
+	Month       string            `json:"month"`
+	EnrolmentID string            `json:"enrolment_id,omitempty"`
+	BatchID     string            `json:"batch_id,omitempty"`
+	Subject     string            `json:"subject,omitempty"`
+	Base        float64           `json:"base"`
+	Source      string            `json:"source"` // batch, enrolment, or student for a hand-typed fee
+	Discounts   []AppliedDiscount `json:"discounts"`
+	Effective   float64           `json:"effective"`
+	Days        int               `json:"days,omitempty"` // days charged when a transfer splits the month
+	Parts       []*Fee            `json:"parts,omitempty"`
+}
+
+type AppliedDiscount struct {
+	RuleID     string  `json:"rule_id"`
+	Name       string  `json:"name"`
+	Amount     float64 `json:"amount"`
+	ApprovedBy string  `json:"approved_by"`
+}
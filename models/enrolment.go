@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Enrolment states
+const (
+	EnrolmentActive = "active"
+	EnrolmentEnded  = "ended"
+)
+
+// Enrolment puts a student in one batch with its own fee. A student taking
+// Physics and Chemistry has two. The batch fields on Student mirror the
+// first active one for screens that only know about one batch.
+type Enrolment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StudentID string             `bson:"student_id" json:"student_id"`
+	BatchID   string             `bson:"batch_id" json:"batch_id"`
+	BatchTime string             `bson:"batch_time" json:"batch_time"` // batch name, as on Student
+	Class     string             `bson:"class" json:"class"`
+	Subject   string             `bson:"subject" json:"subject"`
+	Fee       float64            `bson:"fee" json:"fee"` // monthly fee, 0 to charge the batch fee
+	Status    string             `bson:"status" json:"status"`
+	Start     string             `bson:"start" json:"start"`                 // 2006-01-02, empty for enrolments from before they were kept
+	End       string             `bson:"end,omitempty" json:"end,omitempty"` // last day, set when ended
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+
+	// Set on both sides of a batch transfer
+	TransferredFrom string `bson:"transferred_from,omitempty" json:"transferred_from,omitempty"` // enrolment this one replaced
+	TransferredTo   string `bson:"transferred_to,omitempty" json:"transferred_to,omitempty"`     // enrolment that replaced this one
+	Prorate         bool   `bson:"prorate,omitempty" json:"prorate,omitempty"`                   // split the transfer month's fee by days
+}
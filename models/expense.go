@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Expense categories. Paid payslips count as salaries in reports without
+// being entered here.
+const (
+	ExpenseRent      = "rent"
+	ExpenseUtilities = "utilities"
+	ExpensePrinting  = "printing"
+	ExpenseSalaries  = "salaries"
+	ExpenseSupplies  = "supplies"
+	ExpenseOther     = "other"
+)
+
+var ExpenseCategories = []string{
+	ExpenseRent, ExpenseUtilities, ExpensePrinting, ExpenseSalaries, ExpenseSupplies, ExpenseOther,
+}
+
+// Attachment is a receipt or bill stored in GridFS
+type Attachment struct {
+	FileID      primitive.ObjectID `bson:"file_id" json:"file_id"`
+	Filename    string             `bson:"filename" json:"filename"`
+	ContentType string             `bson:"content_type" json:"content_type"`
+	Size        int64              `bson:"size" json:"size"`
+}
+
+type Expense struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Date        string             `bson:"date" json:"date"` // 2006-01-02
+	Category    string             `bson:"category" json:"category"`
+	Description string             `bson:"description" json:"description"`
+	Amount      float64            `bson:"amount" json:"amount"`
+	Attachments []Attachment       `bson:"attachments" json:"attachments"`
+	RecordedBy  string             `bson:"recorded_by" json:"recorded_by"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	HolidayCentre    = "holiday"   // the centre is closed
+	HolidayCancelled = "cancelled" // one batch's class is called off
+)
+
+// Holiday is a day classes don't happen, for the whole centre (no BatchID)
+// or a single batch. A make-up class can be set for another day.
+type Holiday struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Date       string             `bson:"date" json:"date"` // 2006-01-02
+	BatchID    string             `bson:"batch_id" json:"batch_id"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Reason     string             `bson:"reason" json:"reason"`
+	MakeUpDate string             `bson:"make_up_date,omitempty" json:"make_up_date,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invoice states. An issued invoice turns paid when the month is paid and
+// back to issued if that payment is voided.
+const (
+	InvoiceDraft  = "draft"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+// Invoice is a formal bill for one student's month, for guardians and
+// sponsors who need one. Its lines are worked out the same way as the
+// lines of a payment.
+type Invoice struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Number      string             `bson:"number,omitempty" json:"number,omitempty"` // given on issue, e.g. INV-2025-26-00012
+	StudentID   string             `bson:"student_id" json:"student_id"`
+	StudentName string             `bson:"student_name" json:"student_name"`
+	BillTo      string             `bson:"bill_to" json:"bill_to"`
+	BatchID     string             `bson:"batch_id" json:"batch_id"`
+	Class       string             `bson:"class" json:"class"`
+	Subject     string             `bson:"subject" json:"subject"`
+	Month       string             `bson:"month" json:"month"` // 2006-01
+	Lines       []PaymentLine      `bson:"lines" json:"lines"`
+	Total       float64            `bson:"total" json:"total"`
+	DueDate     string             `bson:"due_date" json:"due_date"` // 2006-01-02
+	Status      string             `bson:"status" json:"status"`
+	IssuedAt    *time.Time         `bson:"issued_at,omitempty" json:"issued_at,omitempty"`
+	PaymentID   string             `bson:"payment_id,omitempty" json:"payment_id,omitempty"`
+	ReceiptNo   string             `bson:"receipt_no,omitempty" json:"receipt_no,omitempty"`
+	PaidAt      *time.Time         `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	VoidReason  string             `bson:"void_reason,omitempty" json:"void_reason,omitempty"`
+	CreatedBy   string             `bson:"created_by" json:"created_by"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
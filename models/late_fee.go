@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of late fee
+const (
+	LateFeeFlat    = "flat"    // Amount taka
+	LateFeePercent = "percent" // Amount percent of the month's fee
+)
+
+// LateFeePolicy says what is charged once a month's fee is GraceDays past
+// the first of the month. A policy with a BatchID overrides the general one
+// for students whose record is in that batch; late fees are per student,
+// not per enrolment.
+type LateFeePolicy struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	BatchID   string             `bson:"batch_id" json:"batch_id"`
+	GraceDays int                `bson:"grace_days" json:"grace_days"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Amount    float64            `bson:"amount" json:"amount"`
+	Cap       float64            `bson:"cap" json:"cap"` // most charged per month, 0 for no cap
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// LateFee is the charge for one student's overdue month
+type LateFee struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StudentID   string             `bson:"student_id" json:"student_id"`
+	StudentName string             `bson:"student_name" json:"student_name"`
+	BatchID     string             `bson:"batch_id" json:"batch_id"`
+	Month       string             `bson:"month" json:"month"` // 2006-01
+	PolicyID    string             `bson:"policy_id" json:"policy_id"`
+	Amount      float64            `bson:"amount" json:"amount"`
+	AppliedAt   time.Time          `bson:"applied_at" json:"applied_at"`
+	PaymentID   string             `bson:"payment_id,omitempty" json:"payment_id,omitempty"` // set once collected
+	Waived      bool               `bson:"waived" json:"waived"`
+	WaivedBy    string             `bson:"waived_by,omitempty" json:"waived_by,omitempty"`
+	WaivedAt    *time.Time         `bson:"waived_at,omitempty" json:"waived_at,omitempty"`
+	WaiveReason string             `bson:"waive_reason,omitempty" json:"waive_reason,omitempty"`
+}
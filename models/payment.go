@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payment is money received from a student for one or more months
+type Payment struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ReceiptNo     string             `bson:"receipt_no" json:"receipt_no"` // e.g. 2025-26-00042, counted per July-June year
+	StudentID     string             `bson:"student_id" json:"student_id"`
+	StudentName   string             `bson:"student_name" json:"student_name"`
+	BatchID       string             `bson:"batch_id" json:"batch_id"`
+	Class         string             `bson:"class" json:"class"`
+	Subject       string             `bson:"subject" json:"subject"`
+	Months        []string           `bson:"months" json:"months"` // 2006-01
+	Amount        float64            `bson:"amount" json:"amount"`
+	Lines         []PaymentLine      `bson:"lines" json:"lines"`
+	Method        string             `bson:"method" json:"method"`
+	TransactionID string             `bson:"transaction_id,omitempty" json:"transaction_id,omitempty"`
+	SenderNumber  string             `bson:"sender_number,omitempty" json:"sender_number,omitempty"`
+	PaidAt        time.Time          `bson:"paid_at" json:"paid_at"`
+	CollectedBy   string             `bson:"collected_by" json:"collected_by"`
+	Void          bool               `bson:"void" json:"void"`
+	VoidedAt      *time.Time         `bson:"voided_at,omitempty" json:"voided_at,omitempty"`
+}
+
+// How a payment was made. Wallet payments carry the transaction ID and
+// sender number, bank transfers their reference as the transaction ID.
+const (
+	MethodCash  = "cash"
+	MethodBkash = "bkash"
+	MethodNagad = "nagad"
+	MethodBank  = "bank"
+)
+
+// Kinds of payment line
+const (
+	LineFee     = "fee"
+	LineLateFee = "late_fee"
+	LineCredit  = "credit" // a credit note spent, negative
+)
+
+// PaymentLine is one item a payment is made up of
+type PaymentLine struct {
+	Kind        string  `bson:"kind" json:"kind"`
+	Description string  `bson:"description" json:"description"`
+	Amount      float64 `bson:"amount" json:"amount"`
+	LateFeeID   string  `bson:"late_fee_id,omitempty" json:"late_fee_id,omitempty"`
+	RefundID    string  `bson:"refund_id,omitempty" json:"refund_id,omitempty"`
+	EnrolmentID string  `bson:"enrolment_id,omitempty" json:"enrolment_id,omitempty"` // fee lines
+	BatchID     string  `bson:"batch_id,omitempty" json:"batch_id,omitempty"`
+}
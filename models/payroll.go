@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of pay rule
+const (
+	PayFixed    = "fixed"     // Amount every month
+	PayPerClass = "per_class" // Amount for each class held
+	PayFeeShare = "fee_share" // Percent of the fees collected
+)
+
+// PayRule is one way a staff member earns. BatchID limits per-class and
+// fee-share rules to one batch; empty means all batches they teach.
+type PayRule struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StaffID   string             `bson:"staff_id" json:"staff_id"`
+	Type      string             `bson:"type" json:"type"`
+	Amount    float64            `bson:"amount" json:"amount"`
+	Percent   float64            `bson:"percent" json:"percent"`
+	BatchID   string             `bson:"batch_id" json:"batch_id"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type PayslipLine struct {
+	RuleID      string  `bson:"rule_id" json:"rule_id"`
+	Description string  `bson:"description" json:"description"`
+	Quantity    float64 `bson:"quantity" json:"quantity"`
+	Rate        float64 `bson:"rate" json:"rate"`
+	Amount      float64 `bson:"amount" json:"amount"`
+}
+
+// Payslip is what a staff member earned in a month and whether it was paid
+type Payslip struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	StaffID   string             `bson:"staff_id" json:"staff_id"`
+	StaffName string             `bson:"staff_name" json:"staff_name"`
+	Month     string             `bson:"month" json:"month"` // 2006-01
+	Lines     []PayslipLine      `bson:"lines" json:"lines"`
+	Total     float64            `bson:"total" json:"total"`
+	Paid      bool               `bson:"paid" json:"paid"`
+	PaidAt    *time.Time         `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	PaidBy    string             `bson:"paid_by,omitempty" json:"paid_by,omitempty"`
+	PayMethod string             `bson:"pay_method,omitempty" json:"pay_method,omitempty"`
+	PayNote   string             `bson:"pay_note,omitempty" json:"pay_note,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
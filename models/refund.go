@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of money going back to a student
+const (
+	RefundCash = "refund"      // paid back in cash
+	CreditNote = "credit_note" // kept as credit towards the next payment
+)
+
+// Refund approval states
+const (
+	RefundPending  = "pending"
+	RefundApproved = "approved"
+	RefundRejected = "rejected"
+)
+
+// Refund takes back part or all of a payment. It needs an admin's
+// approval before it counts anywhere. Credit notes are spent through
+// credit lines on later payments.
+type Refund struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Number       string             `bson:"number,omitempty" json:"number,omitempty"` // given on approval, e.g. CN-2025-26-00003
+	Kind         string             `bson:"kind" json:"kind"`
+	PaymentID    string             `bson:"payment_id" json:"payment_id"`
+	ReceiptNo    string             `bson:"receipt_no" json:"receipt_no"`
+	StudentID    string             `bson:"student_id" json:"student_id"`
+	StudentName  string             `bson:"student_name" json:"student_name"`
+	BatchID      string             `bson:"batch_id" json:"batch_id"`
+	Amount       float64            `bson:"amount" json:"amount"`
+	Reason       string             `bson:"reason" json:"reason"`
+	Status       string             `bson:"status" json:"status"`
+	RequestedBy  string             `bson:"requested_by" json:"requested_by"`
+	RequestedAt  time.Time          `bson:"requested_at" json:"requested_at"`
+	DecidedBy    string             `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+	DecidedAt    *time.Time         `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	DecisionNote string             `bson:"decision_note,omitempty" json:"decision_note,omitempty"`
+}
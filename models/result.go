@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Exam is one sitting of a test, e.g. "Weekly Test 3" for a batch.
+type Exam struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name         string             `bson:"name" json:"name"`
+	Date         time.Time          `bson:"date" json:"date"`
+	Class        string             `bson:"class" json:"class"`
+	Subject      string             `bson:"subject" json:"subject"`
+	BatchID      string             `bson:"batch_id" json:"batch_id"`
+	FullMarks    float64            `bson:"full_marks" json:"full_marks"`
+	Participants int                `bson:"participants" json:"participants"`
+	SubmittedBy  string             `bson:"submitted_by" json:"submitted_by"` // Staff ID
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Result is a single student's marks in an exam
+type Result struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ExamID      primitive.ObjectID `bson:"exam_id" json:"exam_id"`
+	StudentID   string             `bson:"student_id" json:"student_id"`
+	Name        string             `bson:"name" json:"name"`
+	PhoneNumber string             `bson:"phone_number" json:"phone_number"`
+	CQ          string             `bson:"cq" json:"cq"`
+	MCQ         string             `bson:"mcq" json:"mcq"`
+	Total       int                `bson:"total" json:"total"`
+	Absent      bool               `bson:"absent" json:"absent"`
+	Rank        int                `bson:"rank" json:"rank"`
+	Remarks     string             `bson:"remarks" json:"remarks"`
+}
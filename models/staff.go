@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StaffTeacher   = "teacher"
+	StaffAdmin     = "admin"
+	StaffFrontDesk = "front_desk"
+
+	StaffActive   = "active"
+	StaffInactive = "inactive"
+)
+
+// Staff is anyone working at the centre; teachers get assigned to batches
+type Staff struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        string             `bson:"name" json:"name"`
+	Phone       string             `bson:"phone" json:"phone"`
+	Role        string             `bson:"role" json:"role"`
+	Subjects    []string           `bson:"subjects" json:"subjects"`
+	JoiningDate string             `bson:"joining_date" json:"joining_date"` // 2006-01-02
+	Status      string             `bson:"status" json:"status"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
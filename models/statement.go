@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Statement is a merchant statement downloaded from bKash, Nagad or the
+// bank, kept so it can be reconciled against the payments ledger again
+// later. Only money received is kept.
+type Statement struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Method     string             `bson:"method" json:"method"`
+	Filename   string             `bson:"filename" json:"filename"`
+	From       string             `bson:"from" json:"from"` // 2006-01-02, first and last day on the statement
+	To         string             `bson:"to" json:"to"`
+	Lines      []StatementLine    `bson:"lines" json:"lines,omitempty"`
+	UploadedBy string             `bson:"uploaded_by" json:"uploaded_by"`
+	UploadedAt time.Time          `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// StatementLine is one transaction on a statement
+type StatementLine struct {
+	Row           int       `bson:"row" json:"row"` // row in the uploaded file
+	TransactionID string    `bson:"transaction_id" json:"transaction_id"`
+	Amount        float64   `bson:"amount" json:"amount"`
+	SenderNumber  string    `bson:"sender_number" json:"sender_number"`
+	Time          time.Time `bson:"time" json:"time"`
+}
@@ -13,8 +13,15 @@ type Student struct {
     PaymentAmount float64            `bson:"payment_amount" json:"payment_amount"`
     PaidMonths    []string           `bson:"paid_months" json:"paid_months"`
     DueMonths     []string           `bson:"due_months" json:"due_months"`
-    // satureday , monday, wednesday - smw 
-    // sunday , tuesday, thursday - stt
+    // code of a StudyDayPattern, e.g. smw, stt or regular
     StudyDays     string             `bson:"study_days" json:"study_days"`
     BatchID       string             `bson:"batch_id" json:"batch_id"`
+    // absence alerts go here when set, otherwise to PhoneNumber
+    GuardianPhone string             `bson:"guardian_phone" json:"guardian_phone"`
+    NoAbsenceAlerts bool             `bson:"no_absence_alerts" json:"no_absence_alerts"`
+    // concessions off the batch fee, see Fee
+    Discounts     []StudentDiscount  `bson:"discounts" json:"discounts"`
+    // filled in by the API, not stored
+    Fee           *Fee               `bson:"-" json:"fee,omitempty"`
+    Enrolments    []Enrolment        `bson:"-" json:"enrolments,omitempty"`
 }
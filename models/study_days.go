@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// StudyDayPattern is a named set of weekdays a student comes on, referred
+// to by Student.StudyDays. No weekdays means every day the batch meets.
+type StudyDayPattern struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Code     string             `bson:"code" json:"code"`
+	Label    string             `bson:"label" json:"label"`
+	Weekdays []string           `bson:"weekdays" json:"weekdays"`
+}
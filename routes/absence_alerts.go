@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultAbsenceTemplate = "Dear guardian, {name} was absent from today's {batch} class ({date}). Please contact {centre} if this is unexpected."
+
+// sendAbsenceAlerts texts the guardian of every absent student in a closed
+// session and tells the admin (ADMIN_PHONE) about students who have now
+// missed ABSENCE_ESCALATE_AFTER classes in a row (default 3).
+// The message can be changed with ABSENCE_SMS_TEMPLATE using the
+// placeholders {name}, {batch}, {date}, {centre} and {count}.
+func sendAbsenceAlerts(session models.AttendanceSession) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var absentIDs []primitive.ObjectID
+	for _, r := range session.Records {
+		if r.Status != models.AttendanceAbsent {
+			continue
+		}
+		if id, err := primitive.ObjectIDFromHex(r.StudentID); err == nil {
+			absentIDs = append(absentIDs, id)
+		}
+	}
+	if len(absentIDs) == 0 {
+		return
+	}
+
+	cursor, err := database.DB.Collection("students").Find(ctx, bson.M{"_id": bson.M{"$in": absentIDs}})
+	if err != nil {
+		log.Println("❌ Failed to load absent students:", err)
+		return
+	}
+	var students []models.Student
+	if err := cursor.All(ctx, &students); err != nil {
+		log.Println("❌ Failed to load absent students:", err)
+		return
+	}
+
+	batch := batchName(ctx, session.BatchID)
+	template := os.Getenv("ABSENCE_SMS_TEMPLATE")
+	if template == "" {
+		template = defaultAbsenceTemplate
+	}
+
+	escalateAfter, err := strconv.Atoi(os.Getenv("ABSENCE_ESCALATE_AFTER"))
+	if err != nil || escalateAfter < 1 {
+		escalateAfter = 3
+	}
+	adminPhone := os.Getenv("ADMIN_PHONE")
+
+	for _, s := range students {
+		streak := consecutiveAbsences(ctx, session.BatchID, s.ID.Hex(), session.Date)
+		values := map[string]string{
+			"name":   s.Name,
+			"batch":  batch,
+			"date":   session.Date,
+			"centre": centreName(),
+			"count":  strconv.Itoa(streak),
+		}
+
+		if !s.NoAbsenceAlerts {
+			phone := s.GuardianPhone
+			if phone == "" {
+				phone = s.PhoneNumber
+			}
+			sendSMS(phone, fillTemplate(template, values))
+		}
+
+		// Only once per run of absences, when it reaches the limit
+		if streak == escalateAfter && adminPhone != "" {
+			sendSMS(adminPhone, fmt.Sprintf("%s (%s) has missed %d %s classes in a row, last on %s.",
+				s.Name, s.PhoneNumber, streak, batch, session.Date))
+		}
+	}
+}
+
+// consecutiveAbsences counts how many of the batch's marked sessions up to
+// and including date the student missed without a break
+func consecutiveAbsences(ctx context.Context, batchID, studentID, date string) int {
+	opts := options.Find().SetSort(bson.M{"date": -1}).SetLimit(30)
+	cursor, err := database.DB.Collection("attendance").Find(ctx, bson.M{
+		"batch_id":           batchID,
+		"records.student_id": studentID,
+		"date":               bson.M{"$lte": date},
+	}, opts)
+	if err != nil {
+		return 0
+	}
+
+	var sessions []models.AttendanceSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0
+	}
+
+	streak := 0
+	for _, s := range sessions {
+		for _, r := range s.Records {
+			if r.StudentID != studentID || r.Status == "" {
+				continue
+			}
+			if r.Status != models.AttendanceAbsent {
+				return streak
+			}
+			streak++
+		}
+	}
+	return streak
+}
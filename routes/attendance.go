@@ -0,0 +1,459 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const dateLayout = "2006-01-02"
+
+// OpenAttendanceRequest is the body of POST /api/attendance/open
+type OpenAttendanceRequest struct {
+	BatchID  string `json:"batch_id"`
+	Date     string `json:"date"`     // defaults to today
+	Override bool   `json:"override"` // allow a day the batch doesn't meet
+}
+
+// MarkAttendanceRequest is the body of PATCH /api/attendance/:id/mark
+type MarkAttendanceRequest struct {
+	Records []models.AttendanceRecord `json:"records"`
+	// Rest sets every record that is still unmarked, e.g. "absent"
+	Rest string `json:"rest"`
+	// Close ends the class and sends the absence alerts
+	Close bool `json:"close"`
+}
+
+// AttendanceSummary counts one student's attendance over a range
+type AttendanceSummary struct {
+	StudentID  string  `json:"student_id"`
+	Name       string  `json:"name"`
+	Sessions   int     `json:"sessions"`
+	Present    int     `json:"present"`
+	Late       int     `json:"late"`
+	Absent     int     `json:"absent"`
+	Percentage float64 `json:"percentage"`
+}
+
+// OpenAttendance creates the session for a batch's class with its roster.
+// Sessions can only be opened on the batch's Days or a make-up day, and not
+// on holidays, unless override is set.
+func OpenAttendance(c *fiber.Ctx) error {
+	var req OpenAttendanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	date := time.Now()
+	if req.Date != "" {
+		d, err := time.ParseInLocation(dateLayout, req.Date, time.Local)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+		}
+		date = d
+	}
+
+	batchID, err := primitive.ObjectIDFromHex(req.BatchID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var batch models.Batch
+	if err := database.DB.Collection("batches").FindOne(ctx, bson.M{"_id": batchID}).Decode(&batch); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Batch not found"})
+	}
+
+	day := date.Format(dateLayout)
+	off, err := loadHolidays(ctx, day, day)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch holidays"})
+	}
+
+	if !req.Override {
+		if h := off.Off(req.BatchID, day); h != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("There is no class on %s (%s); set override to open anyway", day, h.Reason),
+			})
+		}
+		if !batchMeetsOn(batch, date.Weekday()) && !off.MakeUp(req.BatchID, day) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s does not meet on %s; set override to open anyway", batch.BatchName, date.Weekday()),
+			})
+		}
+	}
+
+	sessions := database.DB.Collection("attendance")
+
+	var existing models.AttendanceSession
+	err = sessions.FindOne(ctx, bson.M{"batch_id": req.BatchID, "date": date.Format(dateLayout)}).Decode(&existing)
+	if err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session already open", "session": existing})
+	}
+
+	roster, err := batchRoster(ctx, req.BatchID, date)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+
+	session := models.AttendanceSession{
+		ID:        primitive.NewObjectID(),
+		BatchID:   req.BatchID,
+		Date:      date.Format(dateLayout),
+		Records:   roster,
+		Override:  req.Override,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	if _, err := sessions.InsertOne(ctx, session); err != nil {
+		// Someone else opened the same class between the check and the insert
+		if mongo.IsDuplicateKeyError(err) {
+			if err := sessions.FindOne(ctx, bson.M{"batch_id": req.BatchID, "date": session.Date}).Decode(&existing); err == nil {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Session already open", "session": existing})
+			}
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot open session"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(session)
+}
+
+// GetAttendanceSession returns one session with its records
+func GetAttendanceSession(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var session models.AttendanceSession
+	if err := database.DB.Collection("attendance").FindOne(ctx, bson.M{"_id": objID}).Decode(&session); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	return c.JSON(session)
+}
+
+// MarkAttendance sets the status of many students in a session at once
+func MarkAttendance(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req MarkAttendanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if req.Rest != "" && !validAttendanceStatus(req.Rest) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "rest must be present, absent or late"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("attendance")
+
+	var session models.AttendanceSession
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&session); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	positions := make(map[string]int)
+	for i, r := range session.Records {
+		positions[r.StudentID] = i
+	}
+
+	// Each student is set with its own array filter rather than writing
+	// the whole records array back, so a card scanned meanwhile isn't lost
+	var unknown []string
+	set := bson.M{}
+	var filters []interface{}
+	for _, r := range req.Records {
+		if !validAttendanceStatus(r.Status) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid status %q for %s", r.Status, r.StudentID)})
+		}
+		if _, ok := positions[r.StudentID]; !ok {
+			unknown = append(unknown, r.StudentID)
+			continue
+		}
+		name := fmt.Sprintf("s%d", len(filters))
+		set["records.$["+name+"].status"] = r.Status
+		filters = append(filters, bson.M{name + ".student_id": r.StudentID})
+	}
+
+	now := time.Now()
+	if len(filters) > 0 {
+		set["updated_at"] = now
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": objID}, bson.M{"$set": set},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: filters}))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark attendance"})
+		}
+	}
+
+	if req.Rest != "" {
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": objID},
+			bson.M{"$set": bson.M{"records.$[r].status": req.Rest, "updated_at": now}},
+			options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+				bson.M{"r.status": ""},
+			}}),
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to mark attendance"})
+		}
+	}
+
+	// Alerts only go out the first time a session is closed; the filter on
+	// closed makes sure only one of two racing closes sends them
+	closing := false
+	if req.Close {
+		res, err := collection.UpdateOne(ctx,
+			bson.M{"_id": objID, "closed": false},
+			bson.M{"$set": bson.M{"closed": true, "updated_at": now}},
+		)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to close session"})
+		}
+		closing = res.ModifiedCount > 0
+	}
+
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&session); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch session"})
+	}
+
+	if closing {
+		go sendAbsenceAlerts(session)
+	}
+
+	return c.JSON(fiber.Map{"session": session, "not_in_roster": unknown})
+}
+
+// GetStudentAttendance returns a student's attendance percentage over
+// ?from=&to= (YYYY-MM-DD, both optional) with the per-day records
+func GetStudentAttendance(c *fiber.Ctx) error {
+	studentID := c.Params("id")
+	if _, err := primitive.ObjectIDFromHex(studentID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	filter, err := attendanceRangeFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter["records.student_id"] = studentID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := findAttendance(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch attendance"})
+	}
+
+	type day struct {
+		Date    string `json:"date"`
+		BatchID string `json:"batch_id"`
+		Status  string `json:"status"`
+	}
+	days := []day{}
+	summary := summarizeAttendance(sessions)[studentID]
+	if summary == nil {
+		summary = &AttendanceSummary{StudentID: studentID}
+	}
+	for _, s := range sessions {
+		for _, r := range s.Records {
+			if r.StudentID == studentID {
+				days = append(days, day{Date: s.Date, BatchID: s.BatchID, Status: r.Status})
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"summary": summary, "days": days})
+}
+
+// GetBatchAttendance returns per-student and overall percentages of a batch
+func GetBatchAttendance(c *fiber.Ctx) error {
+	batchID := c.Params("id")
+
+	filter, err := attendanceRangeFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	filter["batch_id"] = batchID
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := findAttendance(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch attendance"})
+	}
+
+	students := []*AttendanceSummary{}
+	attended, marked := 0, 0
+	for _, s := range summarizeAttendance(sessions) {
+		students = append(students, s)
+		attended += s.Present + s.Late
+		marked += s.Sessions
+	}
+
+	overall := 0.0
+	if marked > 0 {
+		overall = round2(float64(attended) / float64(marked) * 100)
+	}
+
+	return c.JSON(fiber.Map{
+		"batch_id":   batchID,
+		"sessions":   len(sessions),
+		"percentage": overall,
+		"students":   students,
+	})
+}
+
+// summarizeAttendance counts marked records per student. Late counts as
+// attended; unmarked records are left out of the percentage.
+func summarizeAttendance(sessions []models.AttendanceSession) map[string]*AttendanceSummary {
+	summaries := make(map[string]*AttendanceSummary)
+
+	for _, s := range sessions {
+		for _, r := range s.Records {
+			if r.Status == "" {
+				continue
+			}
+			sum, ok := summaries[r.StudentID]
+			if !ok {
+				sum = &AttendanceSummary{StudentID: r.StudentID, Name: r.Name}
+				summaries[r.StudentID] = sum
+			}
+			sum.Sessions++
+			switch r.Status {
+			case models.AttendancePresent:
+				sum.Present++
+			case models.AttendanceLate:
+				sum.Late++
+			case models.AttendanceAbsent:
+				sum.Absent++
+			}
+		}
+	}
+
+	for _, sum := range summaries {
+		sum.Percentage = round2(float64(sum.Present+sum.Late) / float64(sum.Sessions) * 100)
+	}
+	return summaries
+}
+
+func findAttendance(ctx context.Context, filter bson.M) ([]models.AttendanceSession, error) {
+	opts := options.Find().SetSort(bson.M{"date": 1})
+	cursor, err := database.DB.Collection("attendance").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []models.AttendanceSession
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// attendanceRangeFilter reads ?from= and ?to=. Dates are stored as
+// YYYY-MM-DD so they compare correctly as strings.
+func attendanceRangeFilter(c *fiber.Ctx) (bson.M, error) {
+	filter := bson.M{}
+	dateRange := bson.M{}
+
+	if from := c.Query("from"); from != "" {
+		if _, err := time.Parse(dateLayout, from); err != nil {
+			return nil, fmt.Errorf("from must be YYYY-MM-DD")
+		}
+		dateRange["$gte"] = from
+	}
+	if to := c.Query("to"); to != "" {
+		if _, err := time.Parse(dateLayout, to); err != nil {
+			return nil, fmt.Errorf("to must be YYYY-MM-DD")
+		}
+		dateRange["$lte"] = to
+	}
+
+	if len(dateRange) > 0 {
+		filter["date"] = dateRange
+	}
+	return filter, nil
+}
+
+// batchRoster lists the batch's students who study on that weekday as
+// unmarked records
+func batchRoster(ctx context.Context, batchID string, date time.Time) ([]models.AttendanceRecord, error) {
+	students, err := enrolledStudents(ctx, batchID, date.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roster := make([]models.AttendanceRecord, 0, len(students))
+	for _, s := range students {
+		if !patterns.Attends(s.StudyDays, date.Weekday()) {
+			continue
+		}
+		roster = append(roster, models.AttendanceRecord{StudentID: s.ID.Hex(), Name: s.Name})
+	}
+	return roster, nil
+}
+
+func validAttendanceStatus(status string) bool {
+	switch status {
+	case models.AttendancePresent, models.AttendanceAbsent, models.AttendanceLate:
+		return true
+	}
+	return false
+}
+
+// batchMeetsOn reports whether the weekday is one of the batch's days.
+// A batch without any days is treated as meeting every day.
+func batchMeetsOn(batch models.Batch, day time.Weekday) bool {
+	weekdays := batchWeekdays(batch)
+	if len(weekdays) == 0 {
+		return true
+	}
+	for _, wd := range weekdays {
+		if wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeekday accepts full or short day names in any case ("Saturday", "sat")
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) < 3 {
+		return 0, false
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.HasPrefix(strings.ToLower(d.String()), s) {
+			return d, true
+		}
+	}
+	return 0, false
+}
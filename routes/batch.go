@@ -46,6 +46,11 @@ func AddBatch(c *fiber.Ctx) error {
 
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
+
+    // validate the schedule and make sure the room/teacher is free
+    if status, body := checkBatchSchedule(ctx, &batch); status != 0 {
+        return c.Status(status).JSON(body)
+    }
    
     _, err := batchCollection.InsertOne(ctx, batch)
     if err != nil {
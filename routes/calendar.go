@@ -0,0 +1,334 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // the server image may not ship a zoneinfo database
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Calendar feeds exist for these kinds of owners
+const (
+	calendarBatch   = "batch"
+	calendarTeacher = "teacher"
+	calendarStudent = "student"
+)
+
+var icalDays = map[time.Weekday]string{
+	time.Sunday: "SU", time.Monday: "MO", time.Tuesday: "TU", time.Wednesday: "WE",
+	time.Thursday: "TH", time.Friday: "FR", time.Saturday: "SA",
+}
+
+// calendarEvent is one weekly recurring class in a feed
+type calendarEvent struct {
+	Batch    models.Batch
+	Schedule *models.Schedule
+	Weekdays []time.Weekday
+	// dates (YYYY-MM-DD) on which the class doesn't happen
+	Exceptions []string
+	// extra dates for make-up classes
+	MakeUps []string
+}
+
+// GetCalendarLink returns the feed URL for ?kind=batch|teacher|student&id=.
+// Teacher feeds are keyed by staff ID, or by the teacher named in batch
+// schedules for teachers without a staff record.
+func GetCalendarLink(c *fiber.Ctx) error {
+	if err := auth.CheckSecret(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	kind, id := c.Query("kind"), c.Query("id")
+	if kind != calendarBatch && kind != calendarTeacher && kind != calendarStudent {
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be batch, teacher or student"})
+	}
+	if id == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "id is required"})
+	}
+
+	path := fmt.Sprintf("/calendar/%s/%s/%s.ics", kind, url.PathEscape(id), calendarToken(kind, id))
+	base := os.Getenv("PUBLIC_URL")
+	if base == "" {
+		base = c.BaseURL()
+	}
+
+	return c.JSON(fiber.Map{"url": strings.TrimRight(base, "/") + path})
+}
+
+// CalendarFeed serves the .ics feed behind a link from GetCalendarLink
+func CalendarFeed(c *fiber.Ctx) error {
+	if err := auth.CheckSecret(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).SendString(err.Error())
+	}
+	kind := c.Params("kind")
+	id, err := url.PathUnescape(c.Params("id"))
+	if err != nil {
+		return c.Status(404).SendString("Not found")
+	}
+	token := strings.TrimSuffix(c.Params("token"), ".ics")
+	if !auth.Verify("calendar:"+kind+":"+id, token) {
+		return c.Status(404).SendString("Not found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, name, err := calendarEvents(ctx, kind, id)
+	if err != nil {
+		return c.Status(404).SendString("Not found")
+	}
+
+	c.Set("Content-Type", "text/calendar; charset=utf-8")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s.ics\"", safeFilename(name)))
+	return c.SendString(buildCalendar(name, kind+"-"+id, events))
+}
+
+// Signs kind and id so feed URLs can't be guessed but never change
+func calendarToken(kind, id string) string {
+	return auth.Sign("calendar:" + kind + ":" + id)
+}
+
+// calendarEvents collects the classes of a feed and a display name for it
+func calendarEvents(ctx context.Context, kind, id string) ([]calendarEvent, string, error) {
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	off, err := loadHolidays(ctx, "", "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var events []calendarEvent
+	var name string
+
+	switch kind {
+	case calendarBatch:
+		for _, b := range batches {
+			if b.ID.Hex() == id {
+				name = b.BatchName
+				if s := batchSchedule(b); s != nil {
+					events = append(events, calendarEvent{Batch: b, Schedule: s, Weekdays: batchWeekdays(b)})
+				}
+			}
+		}
+		if name == "" {
+			return nil, "", fmt.Errorf("batch not found")
+		}
+
+	case calendarTeacher:
+		name = id
+		if staff, err := findStaff(ctx, id); err == nil {
+			name = staff.Name
+		}
+		for _, b := range batches {
+			s := batchSchedule(b)
+			if s == nil {
+				continue
+			}
+			assigned := strings.EqualFold(s.Teacher, id)
+			for _, t := range b.TeacherIDs {
+				assigned = assigned || t == id
+			}
+			if assigned {
+				events = append(events, calendarEvent{Batch: b, Schedule: s, Weekdays: batchWeekdays(b)})
+			}
+		}
+
+	case calendarStudent:
+		objID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, "", err
+		}
+		var student models.Student
+		if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student); err != nil {
+			return nil, "", err
+		}
+		patterns, err := loadStudyDays(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		name = student.Name
+		for _, b := range batches {
+			s := batchSchedule(b)
+			if b.ID.Hex() != student.BatchID || s == nil {
+				continue
+			}
+			// Only the days the student actually comes
+			var days []time.Weekday
+			for _, wd := range batchWeekdays(b) {
+				if patterns.Attends(student.StudyDays, wd) {
+					days = append(days, wd)
+				}
+			}
+			if len(days) > 0 {
+				events = append(events, calendarEvent{Batch: b, Schedule: s, Weekdays: days})
+			}
+		}
+
+	default:
+		return nil, "", fmt.Errorf("unknown calendar kind")
+	}
+
+	for i := range events {
+		batchID := events[i].Batch.ID.Hex()
+		events[i].Exceptions = off.Exceptions(batchID)
+		events[i].MakeUps = off.MakeUps(batchID)
+	}
+
+	return events, name, nil
+}
+
+// buildCalendar writes an RFC 5545 calendar with one weekly recurring
+// event per class
+func buildCalendar(name, uidPrefix string, events []calendarEvent) string {
+	loc := centreLocation()
+	now := time.Now().UTC().Format("20060102T150405Z")
+
+	var b strings.Builder
+	line := func(s string) { b.WriteString(foldICalLine(s)) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//" + icalText(centreName()) + "//CMS//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + icalText(name))
+	line("X-WR-TIMEZONE:" + loc.String())
+	writeTimezone(line, loc)
+
+	for _, e := range events {
+		start, _ := time.Parse("15:04", e.Schedule.Start)
+		end, _ := time.Parse("15:04", e.Schedule.End)
+
+		// The series starts on the first class day since the batch was made
+		first := e.Batch.ID.Timestamp().In(loc)
+		first = time.Date(first.Year(), first.Month(), first.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+		for !containsWeekday(e.Weekdays, first.Weekday()) {
+			first = first.AddDate(0, 0, 1)
+		}
+		last := time.Date(first.Year(), first.Month(), first.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+
+		var byDay []string
+		for _, wd := range e.Weekdays {
+			byDay = append(byDay, icalDays[wd])
+		}
+
+		summary := e.Batch.BatchName
+		if e.Batch.Subject != "" {
+			summary = e.Batch.Subject + " - " + summary
+		}
+
+		line("BEGIN:VEVENT")
+		line(fmt.Sprintf("UID:%s-%s@cms", uidPrefix, e.Batch.ID.Hex()))
+		line("DTSTAMP:" + now)
+		line("DTSTART;TZID=" + loc.String() + ":" + first.Format("20060102T150405"))
+		line("DTEND;TZID=" + loc.String() + ":" + last.Format("20060102T150405"))
+		line("RRULE:FREQ=WEEKLY;BYDAY=" + strings.Join(byDay, ","))
+		for _, d := range e.Exceptions {
+			if day, err := time.ParseInLocation(dateLayout, d, loc); err == nil {
+				ex := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+				line("EXDATE;TZID=" + loc.String() + ":" + ex.Format("20060102T150405"))
+			}
+		}
+		for _, d := range e.MakeUps {
+			if day, err := time.ParseInLocation(dateLayout, d, loc); err == nil {
+				extra := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+				line("RDATE;TZID=" + loc.String() + ":" + extra.Format("20060102T150405"))
+			}
+		}
+		line("SUMMARY:" + icalText(summary))
+		if e.Schedule.Room != "" {
+			line("LOCATION:" + icalText(e.Schedule.Room))
+		}
+		description := "Class " + e.Batch.Class
+		if e.Schedule.Teacher != "" {
+			description += ", teacher " + e.Schedule.Teacher
+		}
+		line("DESCRIPTION:" + icalText(description))
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// writeTimezone describes the centre's zone with its current offset, which
+// is enough for zones without daylight saving like Asia/Dhaka
+func writeTimezone(line func(string), loc *time.Location) {
+	_, offset := time.Now().In(loc).Zone()
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	utcOffset := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+
+	line("BEGIN:VTIMEZONE")
+	line("TZID:" + loc.String())
+	line("BEGIN:STANDARD")
+	line("DTSTART:19700101T000000")
+	line("TZOFFSETFROM:" + utcOffset)
+	line("TZOFFSETTO:" + utcOffset)
+	line("END:STANDARD")
+	line("END:VTIMEZONE")
+}
+
+// centreLocation is CENTRE_TIMEZONE, Asia/Dhaka by default
+func centreLocation() *time.Location {
+	name := os.Getenv("CENTRE_TIMEZONE")
+	if name == "" {
+		name = "Asia/Dhaka"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone(name, 6*60*60)
+	}
+	return loc
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// icalText escapes a TEXT value
+func icalText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// foldICalLine ends a content line with CRLF, folding it so no line is
+// longer than 75 octets: the first holds 75, each continuation a space and
+// 74 more
+func foldICalLine(s string) string {
+	var b strings.Builder
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		// don't split a UTF-8 character
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	b.WriteString(s + "\r\n")
+	return b.String()
+}
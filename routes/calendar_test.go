@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFoldICalLine(t *testing.T) {
+	a := func(n int) string { return strings.Repeat("a", n) }
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"short", "BEGIN:VCALENDAR", "BEGIN:VCALENDAR\r\n"},
+		{"exactly 75 octets", a(75), a(75) + "\r\n"},
+		{"76 octets", a(76), a(75) + "\r\n " + a(1) + "\r\n"},
+		{"continuations hold 74", a(75 + 74 + 1), a(75) + "\r\n " + a(74) + "\r\n " + a(1) + "\r\n"},
+		{"two-byte character across the fold", a(74) + "é", a(74) + "\r\n é\r\n"},
+		{"two-byte character ending at 75", a(73) + "é", a(73) + "é\r\n"},
+		{"three-byte character across the fold", a(74) + "৳" + a(3), a(74) + "\r\n ৳" + a(3) + "\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := foldICalLine(tt.line)
+			if got != tt.want {
+				t.Errorf("foldICalLine() = %q, want %q", got, tt.want)
+			}
+			for _, l := range strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n") {
+				if len(l) > 75 {
+					t.Errorf("line of %d octets: %q", len(l), l)
+				}
+			}
+		})
+	}
+}
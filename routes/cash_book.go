@@ -0,0 +1,173 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CashEntry is one movement of money in the cash book
+type CashEntry struct {
+	Time        time.Time `json:"time"`
+	Kind        string    `json:"kind"` // receipt, refund, expense or salary
+	Reference   string    `json:"reference"`
+	Description string    `json:"description"`
+	In          float64   `json:"in"`
+	Out         float64   `json:"out"`
+	Balance     float64   `json:"balance"`
+}
+
+// GetCashBook lists money in and out between ?from= and ?to= (YYYY-MM-DD,
+// default this month) with a running balance. Only cash is counted:
+// bKash, Nagad and bank receipts go to the bank, not the till. Credit
+// notes move no cash and only show up as smaller receipts when they are
+// spent.
+func GetCashBook(c *fiber.Ctx) error {
+	now := time.Now().In(centreLocation())
+	from := c.Query("from", now.Format(monthLayout)+"-01")
+	to := c.Query("to", now.Format(dateLayout))
+
+	start, err := time.ParseInLocation(dateLayout, from, centreLocation())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be YYYY-MM-DD"})
+	}
+	end, err := time.ParseInLocation(dateLayout, to, centreLocation())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "to must be YYYY-MM-DD"})
+	}
+	if end.Before(start) {
+		return c.Status(400).JSON(fiber.Map{"error": "to is before from"})
+	}
+	end = end.AddDate(0, 0, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Everything before the range makes up the opening balance
+	earlier, err := cashEntries(ctx, time.Time{}, start)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build cash book"})
+	}
+	opening := 0.0
+	for _, e := range earlier {
+		opening += e.In - e.Out
+	}
+
+	entries, err := cashEntries(ctx, start, end)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build cash book"})
+	}
+
+	balance, totalIn, totalOut := opening, 0.0, 0.0
+	for i := range entries {
+		balance += entries[i].In - entries[i].Out
+		entries[i].Balance = round2(balance)
+		totalIn += entries[i].In
+		totalOut += entries[i].Out
+	}
+
+	return c.JSON(fiber.Map{
+		"from":            from,
+		"to":              to,
+		"opening_balance": round2(opening),
+		"entries":         entries,
+		"total_in":        round2(totalIn),
+		"total_out":       round2(totalOut),
+		"closing_balance": round2(balance),
+	})
+}
+
+// cashEntries collects cash receipts, approved cash refunds, expenses and
+// payslips paid in cash from start up to end, in time order
+func cashEntries(ctx context.Context, start, end time.Time) ([]CashEntry, error) {
+	entries := []CashEntry{}
+	timeRange := bson.M{"$gte": start, "$lt": end}
+	// Records from before the method was kept were all cash
+	inCash := bson.M{"$in": bson.A{models.MethodCash, "", nil}}
+
+	var payments []models.Payment
+	if err := findAll(ctx, "payments", bson.M{"void": false, "method": inCash, "paid_at": timeRange}, &payments); err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if p.Amount == 0 {
+			continue
+		}
+		entries = append(entries, CashEntry{
+			Time:        p.PaidAt,
+			Kind:        "receipt",
+			Reference:   p.ReceiptNo,
+			Description: fmt.Sprintf("%s, %s", p.StudentName, receiptPeriod(p.Months)),
+			In:          p.Amount,
+		})
+	}
+
+	var refunds []models.Refund
+	filter := bson.M{"kind": models.RefundCash, "status": models.RefundApproved, "decided_at": timeRange}
+	if err := findAll(ctx, "refunds", filter, &refunds); err != nil {
+		return nil, err
+	}
+	for _, r := range refunds {
+		entries = append(entries, CashEntry{
+			Time:        *r.DecidedAt,
+			Kind:        "refund",
+			Reference:   r.Number,
+			Description: fmt.Sprintf("%s, against %s: %s", r.StudentName, r.ReceiptNo, r.Reason),
+			Out:         r.Amount,
+		})
+	}
+
+	var expenses []models.Expense
+	dateRange := bson.M{"$lt": end.Format(dateLayout)}
+	if !start.IsZero() {
+		dateRange["$gte"] = start.Format(dateLayout)
+	}
+	if err := findAll(ctx, "expenses", bson.M{"date": dateRange}, &expenses); err != nil {
+		return nil, err
+	}
+	for _, e := range expenses {
+		day, err := time.ParseInLocation(dateLayout, e.Date, centreLocation())
+		if err != nil {
+			continue
+		}
+		entries = append(entries, CashEntry{
+			Time:        day,
+			Kind:        "expense",
+			Reference:   e.Category,
+			Description: e.Description,
+			Out:         e.Amount,
+		})
+	}
+
+	var payslips []models.Payslip
+	if err := findAll(ctx, "payslips", bson.M{"paid": true, "pay_method": inCash, "paid_at": timeRange}, &payslips); err != nil {
+		return nil, err
+	}
+	for _, p := range payslips {
+		entries = append(entries, CashEntry{
+			Time:        *p.PaidAt,
+			Kind:        "salary",
+			Reference:   p.Month,
+			Description: p.StaffName,
+			Out:         p.Total,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// findAll decodes every document of a collection matching filter
+func findAll(ctx context.Context, collection string, filter bson.M, results interface{}) error {
+	cursor, err := database.DB.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
+}
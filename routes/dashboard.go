@@ -0,0 +1,560 @@
+package routes
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Legacy due_months entries look like September_2025
+const dueMonthLayout = "January_2006"
+
+// CollectionLine is expected against collected fees for one month, batch,
+// class or subject
+type CollectionLine struct {
+	Key       string  `json:"key"`
+	Label     string  `json:"label,omitempty"`
+	Expected  float64 `json:"expected"`
+	Collected float64 `json:"collected"`
+	Due       float64 `json:"due"`
+	Rate      float64 `json:"collection_rate"` // percent
+}
+
+// Debtor is a student with unpaid months
+type Debtor struct {
+	StudentID   string   `bson:"_id" json:"student_id"`
+	Name        string   `bson:"name" json:"name"`
+	PhoneNumber string   `bson:"phone_number" json:"phone_number"`
+	BatchID     string   `bson:"batch_id" json:"batch_id"`
+	Class       string   `bson:"class" json:"class"`
+	Subject     string   `bson:"subject" json:"subject"`
+	DueMonths   []string `bson:"due_months" json:"due_months"`
+	Owed        float64  `bson:"owed" json:"owed"`
+}
+
+// collectionGroup is one row of the grouped payments or dues pipelines
+type collectionGroup struct {
+	Key struct {
+		Month   string `bson:"month"`
+		BatchID string `bson:"batch_id"`
+		Class   string `bson:"class"`
+		Subject string `bson:"subject"`
+	} `bson:"_id"`
+	Amount float64 `bson:"amount"`
+}
+
+// GetCollectionsDashboard reports expected against collected fees for
+// ?from=&to= (YYYY-MM) by month, batch, class and subject, the age of all
+// outstanding dues, and the ?top= (default 10) biggest debtors. Expected
+// is what was collected for a month plus what is still due for it.
+func GetCollectionsDashboard(c *fiber.Ctx) error {
+	from, to, err := reportMonths(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	top, err := strconv.Atoi(c.Query("top", "10"))
+	if err != nil || top < 1 {
+		return c.Status(400).JSON(fiber.Map{"error": "top must be a positive number"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var months []string
+	start, _, _ := monthBounds(from)
+	_, end, _ := monthBounds(to)
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format(monthLayout))
+	}
+
+	collected, err := collectedByGroup(ctx, months)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sum payments"})
+	}
+	thisMonth := time.Now().In(centreLocation()).Format(monthLayout)
+	dues, err := duesByGroup(ctx, thisMonth)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sum dues"})
+	}
+	debtors, err := topDebtors(ctx, thisMonth, top)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to find debtors"})
+	}
+
+	batchNames := map[string]string{}
+	if batches, err := allBatches(ctx); err == nil {
+		for _, b := range batches {
+			batchNames[b.ID.Hex()] = b.BatchName
+		}
+	}
+
+	inRange := map[string]bool{}
+	for _, m := range months {
+		inRange[m] = true
+	}
+
+	byMonth := collectionTally{}
+	byBatch := collectionTally{}
+	byClass := collectionTally{}
+	bySubject := collectionTally{}
+	total := &CollectionLine{Key: "total"}
+
+	add := func(g collectionGroup, paid bool) {
+		for _, line := range []*CollectionLine{
+			byMonth.line(g.Key.Month, ""),
+			byBatch.line(g.Key.BatchID, batchNames[g.Key.BatchID]),
+			byClass.line(g.Key.Class, ""),
+			bySubject.line(g.Key.Subject, ""),
+			total,
+		} {
+			if paid {
+				line.Collected += g.Amount
+			} else {
+				line.Due += g.Amount
+			}
+		}
+	}
+	for _, g := range collected {
+		add(g, true)
+	}
+	for _, g := range dues {
+		if inRange[g.Key.Month] {
+			add(g, false)
+		}
+	}
+
+	// Every month in the range gets a row, even an empty one
+	for _, m := range months {
+		byMonth.line(m, "")
+	}
+
+	finishCollectionLine(total)
+	return c.JSON(fiber.Map{
+		"from":        from,
+		"to":          to,
+		"total":       total,
+		"by_month":    byMonth.sorted(),
+		"by_batch":    byBatch.sorted(),
+		"by_class":    byClass.sorted(),
+		"by_subject":  bySubject.sorted(),
+		"dues_aging":  duesAging(dues, time.Now()),
+		"top_debtors": debtors,
+	})
+}
+
+// collectedByGroup sums the non-void payments for the given months. A
+// payment for several months counts an equal share towards each.
+func collectedByGroup(ctx context.Context, months []string) ([]collectionGroup, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"void": false, "months": bson.M{"$in": months}}}},
+		{{Key: "$addFields", Value: bson.M{"share": bson.M{"$divide": bson.A{"$amount", bson.M{"$size": "$months"}}}}}},
+		{{Key: "$unwind", Value: "$months"}},
+		{{Key: "$match", Value: bson.M{"months": bson.M{"$in": months}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"month":    "$months",
+				"batch_id": "$batch_id",
+				"class":    "$class",
+				"subject":  "$subject",
+			},
+			"amount": bson.M{"$sum": "$share"},
+		}}},
+	}
+
+	cursor, err := database.DB.Collection("payments").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []collectionGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// owedFeesPipeline turns students into one document per fee they still
+// owe: for each unpaid month (the due_months written by the monthly
+// export, plus this month while they haven't paid it) the fee of each
+// enrolment charged that month, after discounts, unless it was paid by
+// itself. Students without enrolments owe the fee of the batch on their
+// record. The fee is worked out as feeCalculator.fee does it, so keep the
+// two in step.
+func owedFeesPipeline(thisMonth string) mongo.Pipeline {
+	str := func(field string) bson.M { return bson.M{"$ifNull": bson.A{field, ""}} }
+	substr := func(field string, from, n int) bson.M { return bson.M{"$substrBytes": bson.A{str(field), from, n}} }
+
+	// September_2025 becomes 2025-09, or null when it doesn't parse
+	monthNames := bson.A{}
+	for m := time.January; m <= time.December; m++ {
+		monthNames = append(monthNames, m.String())
+	}
+	dueMonth := bson.M{"$let": bson.M{
+		"vars": bson.M{"parts": bson.M{"$split": bson.A{"$$label", "_"}}},
+		"in": bson.M{"$let": bson.M{
+			"vars": bson.M{
+				"m":    bson.M{"$indexOfArray": bson.A{monthNames, bson.M{"$arrayElemAt": bson.A{"$$parts", 0}}}},
+				"year": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$$parts", 1}}, ""}},
+			},
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$size": "$$parts"}, 2}},
+					bson.M{"$gte": bson.A{"$$m", 0}},
+					bson.M{"$regexMatch": bson.M{"input": "$$year", "regex": `^\d{4}$`}},
+				}},
+				bson.M{"$concat": bson.A{
+					"$$year", "-",
+					bson.M{"$cond": bson.A{bson.M{"$lt": bson.A{"$$m", 9}}, "0", ""}},
+					bson.M{"$toString": bson.M{"$add": bson.A{"$$m", 1}}},
+				}},
+				nil,
+			}},
+		}},
+	}}
+
+	// The part of the month an enrolment ($$e) is charged for, as
+	// transferShare works it out
+	inMonth := func(field string) bson.M { return bson.M{"$eq": bson.A{substr(field, 0, 7), "$month"}} }
+	share := bson.M{"$let": bson.M{
+		"vars": bson.M{
+			"first": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{bson.M{"$ne": bson.A{str("$$e.transferred_from"), ""}}, inMonth("$$e.start")}},
+				bson.M{"$toInt": substr("$$e.start", 8, 2)},
+				1,
+			}},
+			"last": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{bson.M{"$ne": bson.A{str("$$e.transferred_to"), ""}}, inMonth("$$e.end")}},
+				bson.M{"$toInt": substr("$$e.end", 8, 2)},
+				"$month_days",
+			}},
+		},
+		"in": bson.M{"$let": bson.M{
+			"vars": bson.M{
+				"days":    bson.M{"$subtract": bson.A{bson.M{"$add": bson.A{"$$last", 1}}, "$$first"}},
+				"prorate": bson.M{"$eq": bson.A{"$$e.prorate", true}},
+			},
+			"in": bson.M{"$switch": bson.M{
+				"branches": bson.A{
+					bson.M{"case": bson.M{"$gte": bson.A{"$$days", "$month_days"}}, "then": 1},
+					bson.M{"case": bson.M{"$lte": bson.A{"$$days", 0}}, "then": 0},
+					bson.M{"case": bson.M{"$and": bson.A{bson.M{"$not": bson.A{"$$prorate"}}, bson.M{"$gt": bson.A{"$$first", 1}}}}, "then": 0},
+					bson.M{"case": bson.M{"$not": bson.A{"$$prorate"}}, "then": 1},
+				},
+				"default": bson.M{"$divide": bson.A{"$$days", "$month_days"}},
+			}},
+		}},
+	}}
+	enrolled := bson.M{"$and": bson.A{
+		bson.M{"$or": bson.A{bson.M{"$eq": bson.A{str("$$e.start"), ""}}, bson.M{"$lte": bson.A{substr("$$e.start", 0, 7), "$month"}}}},
+		bson.M{"$or": bson.A{bson.M{"$eq": bson.A{str("$$e.end"), ""}}, bson.M{"$gte": bson.A{substr("$$e.end", 0, 7), "$month"}}}},
+	}}
+
+	// The discounts ($$d) given that month, with their rule
+	rule := bson.M{"$arrayElemAt": bson.A{bson.M{"$filter": bson.M{
+		"input": "$rules",
+		"as":    "r",
+		"cond":  bson.M{"$eq": bson.A{bson.M{"$toString": "$$r._id"}, "$$d.rule_id"}},
+	}}, 0}}
+	given := bson.M{"$filter": bson.M{
+		"input": bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$discounts", bson.A{}}},
+			"as":    "d",
+			"in":    bson.M{"from": str("$$d.from"), "to": str("$$d.to"), "rule": rule},
+		}},
+		"as": "d",
+		"cond": bson.M{"$and": bson.A{
+			bson.M{"$ne": bson.A{bson.M{"$type": "$$d.rule"}, "missing"}},
+			bson.M{"$gte": bson.A{"$month", "$$d.from"}},
+			bson.M{"$or": bson.A{bson.M{"$eq": bson.A{"$$d.to", ""}}, bson.M{"$lte": bson.A{"$month", "$$d.to"}}}},
+			bson.M{"$cond": bson.A{
+				bson.M{"$ne": bson.A{str("$$d.rule.until"), ""}},
+				bson.M{"$lte": bson.A{"$month", "$$d.rule.until"}},
+				bson.M{"$eq": bson.A{"$$d.rule.active", true}},
+			}},
+		}},
+	}}
+	discountTotal := func(kind string) bson.M {
+		return bson.M{"$sum": bson.M{"$map": bson.M{
+			"input": bson.M{"$filter": bson.M{"input": "$given", "as": "d", "cond": bson.M{"$eq": bson.A{"$$d.rule.kind", kind}}}},
+			"as":    "d",
+			"in":    "$$d.rule.value",
+		}}}
+	}
+
+	// The base of a part ($$p): its enrolment's fee, then the batch fee,
+	// then the student's payment_amount, times its share of the month
+	batchFee := bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": "$batches",
+			"as":    "b",
+			"cond":  bson.M{"$eq": bson.A{bson.M{"$toString": "$$b._id"}, "$$p.batch_id"}},
+		}},
+		"as": "b",
+		"in": "$$b.payment_amount",
+	}}, 0}}, 0}}
+	base := bson.M{"$let": bson.M{
+		"vars": bson.M{"full": bson.M{"$switch": bson.M{
+			"branches": bson.A{
+				bson.M{"case": bson.M{"$gt": bson.A{"$$p.fee", 0}}, "then": "$$p.fee"},
+				bson.M{"case": bson.M{"$gt": bson.A{batchFee, 0}}, "then": batchFee},
+			},
+			"default": bson.M{"$ifNull": bson.A{"$payment_amount", 0}},
+		}}},
+		"in": bson.M{"$cond": bson.A{
+			bson.M{"$lt": bson.A{"$$p.share", 1}},
+			bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$$full", "$$p.share"}}, 2}},
+			"$$full",
+		}},
+	}}
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"due_months.0": bson.M{"$exists": true}},
+			bson.M{"payment_status": bson.M{"$ne": true}},
+		}}}},
+		{{Key: "$addFields", Value: bson.M{
+			"student_id": bson.M{"$toString": "$_id"},
+			"month": bson.M{"$setUnion": bson.A{
+				bson.M{"$filter": bson.M{
+					"input": bson.M{"$map": bson.M{"input": bson.M{"$ifNull": bson.A{"$due_months", bson.A{}}}, "as": "label", "in": dueMonth}},
+					"cond":  bson.M{"$ne": bson.A{"$$this", nil}},
+				}},
+				bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$payment_status", true}}, bson.A{}, bson.A{thisMonth}}},
+			}},
+		}}},
+		{{Key: "$unwind", Value: "$month"}},
+		{{Key: "$addFields", Value: bson.M{
+			"month_days": bson.M{"$dayOfMonth": bson.M{"$dateFromParts": bson.M{
+				"year":  bson.M{"$toInt": bson.M{"$substrBytes": bson.A{"$month", 0, 4}}},
+				"month": bson.M{"$add": bson.A{bson.M{"$toInt": bson.M{"$substrBytes": bson.A{"$month", 5, 2}}}, 1}},
+				"day":   0,
+			}}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "enrolments",
+			"let":  bson.M{"student_id": "$student_id"},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"$expr": bson.M{"$eq": bson.A{"$student_id", "$$student_id"}}}}},
+				{{Key: "$sort", Value: bson.D{{Key: "start", Value: 1}, {Key: "created_at", Value: 1}}}},
+			},
+			"as": "enrolments",
+		}}},
+		{{Key: "$addFields", Value: bson.M{"parts": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$size": "$enrolments"}, 0}},
+			bson.A{bson.M{"enrolment_id": "", "batch_id": str("$batch_id"), "class": str("$class"), "subject": str("$subject"), "fee": 0, "share": 1}},
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$map": bson.M{
+					"input": "$enrolments",
+					"as":    "e",
+					"in": bson.M{
+						"enrolment_id": bson.M{"$toString": "$$e._id"},
+						"batch_id":     str("$$e.batch_id"),
+						"class":        str("$$e.class"),
+						"subject":      bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{str("$$e.subject"), ""}}, str("$subject"), "$$e.subject"}},
+						"fee":          bson.M{"$ifNull": bson.A{"$$e.fee", 0}},
+						"share":        bson.M{"$cond": bson.A{enrolled, share, 0}},
+					},
+				}},
+				"as":   "p",
+				"cond": bson.M{"$gt": bson.A{"$$p.share", 0}},
+			}},
+		}}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "batches",
+			"let":  bson.M{"ids": "$parts.batch_id"},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"$expr": bson.M{"$in": bson.A{bson.M{"$toString": "$_id"}, "$$ids"}}}}},
+				{{Key: "$project", Value: bson.M{"payment_amount": 1}}},
+			},
+			"as": "batches",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "discount_rules",
+			"let":  bson.M{"ids": bson.M{"$ifNull": bson.A{"$discounts.rule_id", bson.A{}}}},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"$expr": bson.M{"$in": bson.A{bson.M{"$toString": "$_id"}, "$$ids"}}}}},
+			},
+			"as": "rules",
+		}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from": "payments",
+			"let":  bson.M{"student_id": "$student_id", "month": "$month"},
+			"pipeline": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{
+					"void":               false,
+					"lines.enrolment_id": bson.M{"$exists": true},
+					"$expr": bson.M{"$and": bson.A{
+						bson.M{"$eq": bson.A{"$student_id", "$$student_id"}},
+						bson.M{"$in": bson.A{"$$month", bson.M{"$ifNull": bson.A{"$months", bson.A{}}}}},
+					}},
+				}}},
+				{{Key: "$unwind", Value: "$lines"}},
+				{{Key: "$match", Value: bson.M{"lines.kind": models.LineFee}}},
+				{{Key: "$project", Value: bson.M{"enrolment_id": "$lines.enrolment_id"}}},
+			},
+			"as": "paid",
+		}}},
+		{{Key: "$addFields", Value: bson.M{"given": given}}},
+		{{Key: "$addFields", Value: bson.M{
+			"percent": discountTotal(models.DiscountPercent),
+			"fixed":   discountTotal(models.DiscountFixed),
+		}}},
+		// Percentage discounts come off each part; fixed ones are given
+		// once, starting with the first part
+		{{Key: "$addFields", Value: bson.M{"parts": bson.M{"$map": bson.M{
+			"input": "$parts",
+			"as":    "p",
+			"in": bson.M{"$mergeObjects": bson.A{"$$p", bson.M{"left": bson.M{"$let": bson.M{
+				"vars": bson.M{"base": base},
+				"in": bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{
+					"$$base",
+					bson.M{"$divide": bson.A{bson.M{"$multiply": bson.A{"$$base", "$percent"}}, 100}},
+				}}}},
+			}}}}},
+		}}}}},
+		{{Key: "$addFields", Value: bson.M{"parts": bson.M{"$reduce": bson.M{
+			"input":        "$parts",
+			"initialValue": bson.M{"fixed": "$fixed", "parts": bson.A{}},
+			"in": bson.M{"$let": bson.M{
+				"vars": bson.M{"off": bson.M{"$min": bson.A{"$$this.left", "$$value.fixed"}}},
+				"in": bson.M{
+					"fixed": bson.M{"$subtract": bson.A{"$$value.fixed", "$$off"}},
+					"parts": bson.M{"$concatArrays": bson.A{"$$value.parts", bson.A{bson.M{"$mergeObjects": bson.A{
+						"$$this",
+						bson.M{"effective": bson.M{"$round": bson.A{bson.M{"$subtract": bson.A{"$$this.left", "$$off"}}, 2}}},
+					}}}}},
+				},
+			}},
+		}}}}},
+		{{Key: "$unwind", Value: "$parts.parts"}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$parts.parts.enrolment_id", "$paid.enrolment_id"}}}}}}},
+		{{Key: "$project", Value: bson.M{
+			"student_id":   1,
+			"name":         1,
+			"phone_number": 1,
+			"batch_id":     1,
+			"class":        1,
+			"subject":      1,
+			"month":        1,
+			"part":         "$parts.parts",
+		}}},
+	}
+}
+
+// duesByGroup sums the fees owed by month, batch, class and subject
+func duesByGroup(ctx context.Context, thisMonth string) ([]collectionGroup, error) {
+	pipeline := append(owedFeesPipeline(thisMonth), bson.D{{Key: "$group", Value: bson.M{
+		"_id": bson.M{
+			"month":    "$month",
+			"batch_id": "$part.batch_id",
+			"class":    "$part.class",
+			"subject":  "$part.subject",
+		},
+		"amount": bson.M{"$sum": "$part.effective"},
+	}}})
+
+	cursor, err := database.DB.Collection("students").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []collectionGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// topDebtors are the students owing the most across all their due months
+func topDebtors(ctx context.Context, thisMonth string, limit int) ([]Debtor, error) {
+	pipeline := append(owedFeesPipeline(thisMonth),
+		bson.D{{Key: "$group", Value: bson.M{
+			"_id":          "$student_id",
+			"name":         bson.M{"$first": "$name"},
+			"phone_number": bson.M{"$first": "$phone_number"},
+			"batch_id":     bson.M{"$first": "$batch_id"},
+			"class":        bson.M{"$first": "$class"},
+			"subject":      bson.M{"$first": "$subject"},
+			"due_months":   bson.M{"$addToSet": "$month"},
+			"owed":         bson.M{"$sum": "$part.effective"},
+		}}},
+		bson.D{{Key: "$match", Value: bson.M{"owed": bson.M{"$gt": 0}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "owed", Value: -1}, {Key: "name", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+
+	cursor, err := database.DB.Collection("students").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	debtors := []Debtor{}
+	if err := cursor.All(ctx, &debtors); err != nil {
+		return nil, err
+	}
+	for i := range debtors {
+		debtors[i].Owed = round2(debtors[i].Owed)
+		sort.Strings(debtors[i].DueMonths)
+	}
+	return debtors, nil
+}
+
+// duesAging buckets outstanding dues by days since their month began
+func duesAging(dues []collectionGroup, now time.Time) []CollectionLine {
+	buckets := []CollectionLine{{Key: "0-30"}, {Key: "31-60"}, {Key: "60+"}}
+	for _, g := range dues {
+		start, _, err := monthBounds(g.Key.Month)
+		if err != nil {
+			continue
+		}
+		days := int(now.Sub(start).Hours() / 24)
+		switch {
+		case days <= 30:
+			buckets[0].Due += g.Amount
+		case days <= 60:
+			buckets[1].Due += g.Amount
+		default:
+			buckets[2].Due += g.Amount
+		}
+	}
+	for i := range buckets {
+		buckets[i].Due = round2(buckets[i].Due)
+	}
+	return buckets
+}
+
+// collectionTally collects CollectionLines by key
+type collectionTally map[string]*CollectionLine
+
+func (t collectionTally) line(key, label string) *CollectionLine {
+	if l, ok := t[key]; ok {
+		return l
+	}
+	l := &CollectionLine{Key: key, Label: label}
+	t[key] = l
+	return l
+}
+
+// sorted returns the finished lines ordered by key
+func (t collectionTally) sorted() []CollectionLine {
+	lines := make([]CollectionLine, 0, len(t))
+	for _, l := range t {
+		finishCollectionLine(l)
+		lines = append(lines, *l)
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Key < lines[j].Key })
+	return lines
+}
+
+func finishCollectionLine(l *CollectionLine) {
+	l.Collected = round2(l.Collected)
+	l.Due = round2(l.Due)
+	l.Expected = round2(l.Collected + l.Due)
+	if l.Expected > 0 {
+		l.Rate = round2(l.Collected / l.Expected * 100)
+	}
+}
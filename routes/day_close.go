@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetDayClose shows the close of ?date= (YYYY-MM-DD, default today), or
+// what it would be if the day is still open
+func GetDayClose(c *fiber.Ctx) error {
+	date := c.Query("date", time.Now().In(centreLocation()).Format(dateLayout))
+	day, err := time.ParseInLocation(dateLayout, date, centreLocation())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var closed models.DayClose
+	err = database.DB.Collection("day_closes").FindOne(ctx, bson.M{"date": date}).Decode(&closed)
+	if err == nil {
+		return c.JSON(fiber.Map{"closed": true, "day_close": closed})
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch day close"})
+	}
+
+	summary, err := buildDayClose(ctx, day)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sum payments"})
+	}
+	return c.JSON(fiber.Map{"closed": false, "day_close": summary})
+}
+
+// GetDayCloses lists the closed days between ?from= and ?to= (YYYY-MM-DD,
+// default this month), newest first
+func GetDayCloses(c *fiber.Ctx) error {
+	now := time.Now().In(centreLocation())
+	from := c.Query("from", now.Format(monthLayout)+"-01")
+	to := c.Query("to", now.Format(dateLayout))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"date": -1})
+	cursor, err := database.DB.Collection("day_closes").Find(ctx, bson.M{"date": bson.M{"$gte": from, "$lte": to}}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch day closes"})
+	}
+
+	closes := []models.DayClose{}
+	if err := cursor.All(ctx, &closes); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse day closes"})
+	}
+	return c.JSON(closes)
+}
+
+// CloseDay hands over a day's cash:
+// {"date": "2006-01-02", "declared_cash": 12500, "note": "..."}.
+// The date defaults to today. The variance against the cash expected from
+// the ledger is kept, and the day's payments are locked.
+func CloseDay(c *fiber.Ctx) error {
+	var req struct {
+		Date         string   `json:"date"`
+		DeclaredCash *float64 `json:"declared_cash"`
+		Note         string   `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Date == "" {
+		req.Date = time.Now().In(centreLocation()).Format(dateLayout)
+	}
+	day, err := time.ParseInLocation(dateLayout, req.Date, centreLocation())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	if day.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot close a day that hasn't started"})
+	}
+	if req.DeclaredCash == nil || *req.DeclaredCash < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "declared_cash is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dc, err := buildDayClose(ctx, day)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sum payments"})
+	}
+	now := time.Now()
+	dc.DeclaredCash = round2(*req.DeclaredCash)
+	dc.Variance = round2(dc.DeclaredCash - dc.ExpectedCash)
+	dc.Note = req.Note
+	dc.ClosedBy = auth.CurrentUser(c)
+	dc.ClosedAt = &now
+
+	// Only the first close of a day is kept, in case two people close at
+	// once; the unique index on date makes the loser's upsert fail
+	res, err := database.DB.Collection("day_closes").UpdateOne(ctx,
+		bson.M{"date": dc.Date},
+		bson.M{"$setOnInsert": dc},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": req.Date + " is already closed"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot save day close"})
+	}
+	if res.UpsertedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": req.Date + " is already closed"})
+	}
+	dc.ID, _ = res.UpsertedID.(primitive.ObjectID)
+
+	return c.Status(fiber.StatusCreated).JSON(dc)
+}
+
+// ReopenDay lets an admin undo a day close, e.g. to declare the cash again
+func ReopenDay(c *fiber.Ctx) error {
+	if !auth.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only an admin can reopen a day"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("day_closes").DeleteOne(ctx, bson.M{"date": c.Params("date")})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reopen day"})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Day is not closed"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Day reopened successfully"})
+}
+
+// buildDayClose sums the day's payments by method and collector. The cash
+// expected in the drawer is the cash taken less cash refunds paid out. Days
+// run by the centre's clock, like receipt numbers.
+func buildDayClose(ctx context.Context, day time.Time) (*models.DayClose, error) {
+	day = day.In(centreLocation())
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, centreLocation())
+	end := start.AddDate(0, 0, 1)
+
+	methods, err := methodTotals(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	dc := &models.DayClose{Date: start.Format(dateLayout), Methods: methods}
+	byCollector := map[string]*models.CollectorTotal{}
+	for _, m := range methods {
+		dc.Count += m.Count
+		dc.Total += m.Amount
+		if m.Method == models.MethodCash {
+			dc.CashIn = m.Amount
+		}
+		for _, ct := range m.Collectors {
+			t, ok := byCollector[ct.CollectedBy]
+			if !ok {
+				t = &models.CollectorTotal{CollectedBy: ct.CollectedBy}
+				byCollector[ct.CollectedBy] = t
+			}
+			t.Count += ct.Count
+			t.Amount = round2(t.Amount + ct.Amount)
+		}
+	}
+	dc.Collectors = []models.CollectorTotal{}
+	for _, t := range byCollector {
+		dc.Collectors = append(dc.Collectors, *t)
+	}
+	sort.Slice(dc.Collectors, func(i, j int) bool { return dc.Collectors[i].CollectedBy < dc.Collectors[j].CollectedBy })
+
+	var refunds []models.Refund
+	filter := bson.M{"kind": models.RefundCash, "status": models.RefundApproved, "decided_at": bson.M{"$gte": start, "$lt": end}}
+	if err := findAll(ctx, "refunds", filter, &refunds); err != nil {
+		return nil, err
+	}
+	for _, r := range refunds {
+		dc.CashRefunded += r.Amount
+	}
+
+	dc.Total = round2(dc.Total)
+	dc.CashRefunded = round2(dc.CashRefunded)
+	dc.ExpectedCash = round2(dc.CashIn - dc.CashRefunded)
+	return dc, nil
+}
+
+// dayLocked reports whether payments made at t are closed to the current
+// user: the day was closed and they aren't an admin
+func dayLocked(ctx context.Context, c *fiber.Ctx, t time.Time) (bool, error) {
+	if auth.IsAdmin(c) {
+		return false, nil
+	}
+	n, err := database.DB.Collection("day_closes").CountDocuments(ctx, bson.M{"date": t.In(centreLocation()).Format(dateLayout)})
+	return n > 0, err
+}
+
+// refreshDayClose sums a closed day again after an admin added or voided
+// a payment on it, or approved a cash refund. The declared cash stays, the
+// variance follows the new totals, and amended_at shows it changed.
+func refreshDayClose(ctx context.Context, t time.Time) error {
+	date := t.In(centreLocation()).Format(dateLayout)
+	var closed models.DayClose
+	err := database.DB.Collection("day_closes").FindOne(ctx, bson.M{"date": date}).Decode(&closed)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	dc, err := buildDayClose(ctx, t)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Collection("day_closes").UpdateByID(ctx, closed.ID, bson.M{"$set": bson.M{
+		"methods":       dc.Methods,
+		"collectors":    dc.Collectors,
+		"count":         dc.Count,
+		"total":         dc.Total,
+		"cash_in":       dc.CashIn,
+		"cash_refunded": dc.CashRefunded,
+		"expected_cash": dc.ExpectedCash,
+		"variance":      round2(closed.DeclaredCash - dc.ExpectedCash),
+		"amended_at":    time.Now(),
+	}})
+	return err
+}
@@ -0,0 +1,454 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GiveDiscountRequest is the body of POST /student/:id/discounts
+type GiveDiscountRequest struct {
+	RuleID     string `json:"rule_id"`
+	From       string `json:"from"` // YYYY-MM, default this month
+	To         string `json:"to"`   // YYYY-MM, empty for no end
+	ApprovedBy string `json:"approved_by"`
+	Note       string `json:"note"`
+}
+
+// GetDiscountRules lists the discount rules; ?active=true hides retired ones
+func GetDiscountRules(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if c.Query("active") == "true" {
+		filter["active"] = true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := database.DB.Collection("discount_rules").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch discount rules"})
+	}
+
+	rules := []models.DiscountRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse discount rules"})
+	}
+	return c.JSON(rules)
+}
+
+// AddDiscountRule creates a rule, e.g. {"name":"Sibling","kind":"percent","value":10}
+func AddDiscountRule(c *fiber.Ctx) error {
+	var rule models.DiscountRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name is required"})
+	}
+	switch rule.Kind {
+	case models.DiscountPercent:
+		if rule.Value <= 0 || rule.Value > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "value must be between 0 and 100"})
+		}
+	case models.DiscountFixed:
+		if rule.Value <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "value must be more than 0"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be percent or fixed"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("discount_rules")
+	count, err := collection.CountDocuments(ctx, bson.M{"name": rule.Name, "active": true})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check discount rules"})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A discount with this name already exists"})
+	}
+
+	rule.ID = primitive.NewObjectID()
+	rule.Active = true
+	rule.CreatedAt = time.Now()
+
+	if _, err := collection.InsertOne(ctx, rule); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert discount rule"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// DeleteDiscountRule retires a rule from ?from= (YYYY-MM, default next
+// month). Students who have it stop getting it from then on; months before
+// keep it, as they may have been billed already.
+func DeleteDiscountRule(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	from, _, err := monthBounds(c.Query("from", time.Now().AddDate(0, 1, 0).Format(monthLayout)))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be YYYY-MM"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("discount_rules").UpdateByID(ctx, objID, bson.M{"$set": bson.M{
+		"active": false,
+		"until":  from.AddDate(0, -1, 0).Format(monthLayout),
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete discount rule"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Discount rule not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Discount rule deleted successfully"})
+}
+
+// GiveDiscount attaches a rule to a student. Every discount needs someone
+// to approve it; the logged in user is assumed when approved_by is empty.
+func GiveDiscount(c *fiber.Ctx) error {
+	studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req GiveDiscountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.From == "" {
+		req.From = time.Now().Format(monthLayout)
+	}
+	if _, _, err := monthBounds(req.From); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be YYYY-MM"})
+	}
+	if req.To != "" {
+		if _, _, err := monthBounds(req.To); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "to must be YYYY-MM"})
+		}
+		if req.To < req.From {
+			return c.Status(400).JSON(fiber.Map{"error": "to is before from"})
+		}
+	}
+	if req.ApprovedBy == "" {
+		req.ApprovedBy = auth.CurrentUser(c)
+	}
+	if req.ApprovedBy == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "approved_by is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rules, err := loadDiscountRules(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch discount rules"})
+	}
+	if rule, ok := rules[req.RuleID]; !ok || !rule.Active {
+		return c.Status(404).JSON(fiber.Map{"error": "Discount rule not found"})
+	}
+
+	collection := database.DB.Collection("students")
+	var student models.Student
+	if err := collection.FindOne(ctx, bson.M{"_id": studentID}).Decode(&student); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+	for _, d := range student.Discounts {
+		if d.RuleID == req.RuleID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Student already has this discount"})
+		}
+	}
+
+	discount := models.StudentDiscount{
+		RuleID:     req.RuleID,
+		From:       req.From,
+		To:         req.To,
+		ApprovedBy: req.ApprovedBy,
+		Note:       req.Note,
+		AddedAt:    time.Now(),
+	}
+
+	// Appended in one update, so grants made at the same time all stay.
+	// discounts may be null on older students, which $push can't add to.
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": studentID, "discounts.rule_id": bson.M{"$ne": req.RuleID}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"discounts": bson.M{"$concatArrays": bson.A{
+			bson.M{"$ifNull": bson.A{"$discounts", bson.A{}}},
+			bson.A{bson.M{"$literal": discount}},
+		}}}}}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update student"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Student already has this discount"})
+	}
+	if err := collection.FindOne(ctx, bson.M{"_id": studentID}).Decode(&student); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch student"})
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+	student.Fee = fees.fee(student, time.Now().Format(monthLayout))
+	return c.Status(fiber.StatusCreated).JSON(student)
+}
+
+// RemoveDiscount takes a rule off a student
+func RemoveDiscount(c *fiber.Ctx) error {
+	studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("students").UpdateByID(ctx, studentID,
+		bson.M{"$pull": bson.M{"discounts": bson.M{"rule_id": c.Params("ruleId")}}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update student"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+	if res.ModifiedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Student doesn't have this discount"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Discount removed successfully"})
+}
+
+// GetStudentFee shows how a student's fee for ?month= (default this month)
+// is made up
+func GetStudentFee(c *fiber.Ctx) error {
+	studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	month := c.Query("month", time.Now().Format(monthLayout))
+	if _, _, err := monthBounds(month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": studentID}).Decode(&student); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+	return c.JSON(fees.fee(student, month))
+}
+
+// feeCalculator works out effective fees from enrolments, batch fees and
+// discount rules
+type feeCalculator struct {
+	batches    map[string]models.Batch
+	rules      map[string]models.DiscountRule
+	enrolments map[string][]models.Enrolment // by student
+}
+
+// newFeeCalculator loads what fees depend on once, for use across many
+// students
+func newFeeCalculator(ctx context.Context) (*feeCalculator, error) {
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := loadDiscountRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	enrolments, err := loadEnrolments(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	fc := &feeCalculator{batches: map[string]models.Batch{}, rules: rules, enrolments: map[string][]models.Enrolment{}}
+	for _, b := range batches {
+		fc.batches[b.ID.Hex()] = b
+	}
+	for _, e := range enrolments {
+		fc.enrolments[e.StudentID] = append(fc.enrolments[e.StudentID], e)
+	}
+	return fc, nil
+}
+
+// fee is the student's fee for a month (YYYY-MM), one part for each
+// enrolment that month. Students without enrolments are charged for the
+// batch on their record.
+func (fc *feeCalculator) fee(s models.Student, month string) *models.Fee {
+	enrolments, ok := fc.enrolments[s.ID.Hex()]
+	if !ok {
+		legacy := fc.partFee(s, models.Enrolment{BatchID: s.BatchID, Subject: s.Subject}, month, map[string]float64{})
+		legacy.Subject = ""
+		return legacy
+	}
+
+	fee := &models.Fee{Month: month, Source: "enrolments", Discounts: []models.AppliedDiscount{}, Parts: []*models.Fee{}}
+	fixedLeft := map[string]float64{}
+	for _, e := range enrolments {
+		if !chargedFor(e, month) {
+			continue
+		}
+		part := fc.partFee(s, e, month, fixedLeft)
+		fee.Parts = append(fee.Parts, part)
+		fee.Base += part.Base
+		fee.Effective += part.Effective
+		fee.Discounts = append(fee.Discounts, part.Discounts...)
+	}
+	if len(fee.Parts) == 1 {
+		fee.Source = fee.Parts[0].Source
+	}
+	fee.Base = round2(fee.Base)
+	fee.Effective = round2(fee.Effective)
+	return fee
+}
+
+// enrolmentFee is one enrolment's part of the student's fee for a month,
+// with whatever share of the fixed discounts falls on it
+func (fc *feeCalculator) enrolmentFee(s models.Student, e models.Enrolment, month string) *models.Fee {
+	for _, part := range fc.fee(s, month).Parts {
+		if part.EnrolmentID == e.ID.Hex() {
+			return part
+		}
+	}
+	return fc.partFee(s, e, month, map[string]float64{})
+}
+
+// partFee is the fee of one enrolment for a month. The base is the
+// enrolment's own fee, then the batch fee, then the student's own
+// payment_amount. Percentage discounts come off each enrolment's base.
+// Fixed ones are given once a month per student: fixedLeft holds what is
+// left of each after the enrolments before this one, so a fixed discount
+// falls on the first charged enrolment and only spills over to the next
+// when it is more than that fee. The fee never goes below zero.
+func (fc *feeCalculator) partFee(s models.Student, e models.Enrolment, month string, fixedLeft map[string]float64) *models.Fee {
+	fee := &models.Fee{
+		Month:     month,
+		BatchID:   e.BatchID,
+		Subject:   e.Subject,
+		Base:      s.PaymentAmount,
+		Source:    "student",
+		Discounts: []models.AppliedDiscount{},
+	}
+	if !e.ID.IsZero() {
+		fee.EnrolmentID = e.ID.Hex()
+	}
+	if b, ok := fc.batches[e.BatchID]; ok && b.Payment_amount > 0 {
+		fee.Base = b.Payment_amount
+		fee.Source = "batch"
+	}
+	if e.Fee > 0 {
+		fee.Base = e.Fee
+		fee.Source = "enrolment"
+	}
+	if share, days := transferShare(e, month); share < 1 {
+		fee.Base = round2(fee.Base * share)
+		fee.Days = days
+	}
+
+	remaining := fee.Base
+	for _, kind := range []string{models.DiscountPercent, models.DiscountFixed} {
+		for _, d := range s.Discounts {
+			rule, ok := fc.rules[d.RuleID]
+			if !ok || !ruleApplies(rule, month) || rule.Kind != kind {
+				continue
+			}
+			if month < d.From || (d.To != "" && month > d.To) {
+				continue
+			}
+
+			amount := rule.Value
+			if kind == models.DiscountPercent {
+				amount = fee.Base * rule.Value / 100
+			} else if left, ok := fixedLeft[d.RuleID]; ok {
+				if left <= 0 {
+					continue // used up on earlier enrolments
+				}
+				amount = left
+			}
+			if amount > remaining {
+				amount = remaining
+			}
+			remaining -= amount
+			if kind == models.DiscountFixed {
+				if _, ok := fixedLeft[d.RuleID]; !ok {
+					fixedLeft[d.RuleID] = rule.Value
+				}
+				fixedLeft[d.RuleID] = round2(fixedLeft[d.RuleID] - amount)
+			}
+
+			fee.Discounts = append(fee.Discounts, models.AppliedDiscount{
+				RuleID:     d.RuleID,
+				Name:       rule.Name,
+				Amount:     round2(amount),
+				ApprovedBy: d.ApprovedBy,
+			})
+		}
+	}
+
+	fee.Effective = round2(remaining)
+	return fee
+}
+
+// ruleApplies reports whether a rule gives its discount in a month. A
+// retired rule still applies up to the month it was retired from; rules
+// retired before that was kept apply no more.
+func ruleApplies(rule models.DiscountRule, month string) bool {
+	if rule.Until != "" {
+		return month <= rule.Until
+	}
+	return rule.Active
+}
+
+// discountReason sums up a fee's discounts for exports, e.g. "Sibling (-150)"
+func discountReason(fee *models.Fee) string {
+	var parts []string
+	for _, d := range fee.Discounts {
+		parts = append(parts, fmt.Sprintf("%s (-%g)", d.Name, d.Amount))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func loadDiscountRules(ctx context.Context) (map[string]models.DiscountRule, error) {
+	cursor, err := database.DB.Collection("discount_rules").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var rules []models.DiscountRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.DiscountRule, len(rules))
+	for _, r := range rules {
+		byID[r.ID.Hex()] = r
+	}
+	return byID, nil
+}
@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/dishan1223/cms/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFeeDiscountsAcrossEnrolments(t *testing.T) {
+	student := models.Student{ID: primitive.NewObjectID()}
+	maths := models.Enrolment{ID: primitive.NewObjectID(), StudentID: student.ID.Hex(), Fee: 1000, Start: "2025-01-01"}
+	physics := models.Enrolment{ID: primitive.NewObjectID(), StudentID: student.ID.Hex(), Fee: 800, Start: "2025-01-01"}
+	rules := map[string]models.DiscountRule{
+		"sibling":     {Name: "Sibling", Kind: models.DiscountFixed, Value: 200, Active: true},
+		"scholarship": {Name: "Scholarship", Kind: models.DiscountFixed, Value: 1500, Active: true},
+		"merit":       {Name: "Merit", Kind: models.DiscountPercent, Value: 10, Active: true},
+	}
+
+	tests := []struct {
+		name  string
+		rules []string
+		want  []float64 // effective fee of maths, then physics
+	}{
+		{"fixed once, on the first enrolment", []string{"sibling"}, []float64{800, 800}},
+		{"fixed over the first fee spills over", []string{"scholarship"}, []float64{0, 300}},
+		{"percent on every enrolment", []string{"merit"}, []float64{900, 720}},
+		{"percent then fixed once", []string{"merit", "sibling"}, []float64{700, 720}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := student
+			for _, id := range tt.rules {
+				s.Discounts = append(s.Discounts, models.StudentDiscount{RuleID: id, From: "2025-01"})
+			}
+			fc := &feeCalculator{
+				batches:    map[string]models.Batch{},
+				rules:      rules,
+				enrolments: map[string][]models.Enrolment{s.ID.Hex(): {maths, physics}},
+			}
+
+			fee := fc.fee(s, "2025-03")
+			if len(fee.Parts) != 2 {
+				t.Fatalf("fee() has %d parts, want 2", len(fee.Parts))
+			}
+			total := 0.0
+			for i, part := range fee.Parts {
+				if part.Effective != tt.want[i] {
+					t.Errorf("part %d effective = %v, want %v", i, part.Effective, tt.want[i])
+				}
+				total += tt.want[i]
+			}
+			if fee.Effective != total {
+				t.Errorf("fee() effective = %v, want %v", fee.Effective, total)
+			}
+			if got := fc.enrolmentFee(s, physics, "2025-03"); got.Effective != tt.want[1] {
+				t.Errorf("enrolmentFee() effective = %v, want %v", got.Effective, tt.want[1])
+			}
+		})
+	}
+}
@@ -0,0 +1,818 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnrolmentRequest is the body of POST /student/:id/enrolments
+type EnrolmentRequest struct {
+	BatchID string  `json:"batch_id"`
+	Class   string  `json:"class"`   // defaults to the batch's
+	Subject string  `json:"subject"` // defaults to the batch's
+	Fee     float64 `json:"fee"`     // 0 to charge the batch fee
+	Start   string  `json:"start"`   // 2006-01-02, default today
+}
+
+// EnrolmentStatus is an enrolment with its fee and whether it is paid for
+// a month
+type EnrolmentStatus struct {
+	models.Enrolment
+	Fee  *models.Fee `json:"fee_due,omitempty"`
+	Paid bool        `json:"paid"`
+}
+
+// GetStudentEnrolments lists all of a student's enrolments, ended ones
+// too, with the fee and payment of each for ?month= (default this month)
+func GetStudentEnrolments(c *fiber.Ctx) error {
+	month := c.Query("month", time.Now().Format(monthLayout))
+	if _, _, err := monthBounds(month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	student, status, err := findStudent(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	enrolments, err := loadEnrolments(ctx, bson.M{"student_id": student.ID.Hex()})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch enrolments"})
+	}
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fees"})
+	}
+	paid, err := paidEnrolments(ctx, month, student.ID.Hex())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payments"})
+	}
+
+	list := []EnrolmentStatus{}
+	for _, e := range enrolments {
+		es := EnrolmentStatus{Enrolment: e, Paid: paid[e.ID.Hex()]}
+		if chargedFor(e, month) {
+			es.Fee = fees.enrolmentFee(*student, e, month)
+		}
+		list = append(list, es)
+	}
+	return c.JSON(list)
+}
+
+// AddEnrolment puts a student in another batch
+func AddEnrolment(c *fiber.Ctx) error {
+	var req EnrolmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Start == "" {
+		req.Start = time.Now().Format(dateLayout)
+	}
+	if _, err := time.Parse(dateLayout, req.Start); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "start must be YYYY-MM-DD"})
+	}
+	if req.Fee < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "fee cannot be negative"})
+	}
+	batchID, err := primitive.ObjectIDFromHex(req.BatchID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	student, status, err := findStudent(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var batch models.Batch
+	if err := database.DB.Collection("batches").FindOne(ctx, bson.M{"_id": batchID}).Decode(&batch); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+
+	already, err := database.DB.Collection("enrolments").CountDocuments(ctx, bson.M{
+		"student_id": student.ID.Hex(),
+		"batch_id":   req.BatchID,
+		"status":     models.EnrolmentActive,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch enrolments"})
+	}
+	if already > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": student.Name + " is already in this batch"})
+	}
+
+	e := models.Enrolment{
+		ID:        primitive.NewObjectID(),
+		StudentID: student.ID.Hex(),
+		BatchID:   req.BatchID,
+		BatchTime: batchLabel(batch),
+		Class:     strings.TrimSpace(req.Class),
+		Subject:   strings.TrimSpace(req.Subject),
+		Fee:       round2(req.Fee),
+		Status:    models.EnrolmentActive,
+		Start:     req.Start,
+		CreatedAt: time.Now(),
+	}
+	if e.Class == "" {
+		e.Class = batch.Class
+	}
+	if e.Subject == "" {
+		e.Subject = batch.Subject
+	}
+
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := insertEnrolment(sc, e); err != nil {
+			return err
+		}
+		return syncStudentBatch(sc, student.ID)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot add enrolment"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(e)
+}
+
+// UpdateEnrolmentFee changes what an enrolment is charged: {"fee": 1200},
+// 0 to go back to the batch fee
+func UpdateEnrolmentFee(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Fee *float64 `json:"fee"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Fee == nil || *req.Fee < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "fee is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var e models.Enrolment
+	err = database.DB.Collection("enrolments").FindOneAndUpdate(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"fee": round2(*req.Fee)}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(404).JSON(fiber.Map{"error": "Enrolment not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update enrolment"})
+	}
+
+	return c.JSON(e)
+}
+
+// EndEnrolment takes a student out of a batch: {"end": "2006-01-02"},
+// default today, the last day they attend
+func EndEnrolment(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		End string `json:"end"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+	if req.End == "" {
+		req.End = time.Now().Format(dateLayout)
+	}
+	if _, err := time.Parse(dateLayout, req.End); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "end must be YYYY-MM-DD"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var e models.Enrolment
+	if err := database.DB.Collection("enrolments").FindOne(ctx, bson.M{"_id": objID}).Decode(&e); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Enrolment not found"})
+	}
+	if e.Status != models.EnrolmentActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Enrolment has already ended"})
+	}
+	if req.End < e.Start {
+		return c.Status(400).JSON(fiber.Map{"error": "end is before the enrolment started"})
+	}
+
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := endEnrolment(sc, &e, req.End); err != nil {
+			return err
+		}
+		studentID, err := primitive.ObjectIDFromHex(e.StudentID)
+		if err != nil {
+			return err
+		}
+		return syncStudentBatch(sc, studentID)
+	})
+	if errors.Is(err, errEnrolmentEnded) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Enrolment has already ended"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to end enrolment"})
+	}
+
+	return c.JSON(e)
+}
+
+// TransferRequest is the body of POST /api/enrolments/:id/transfer
+type TransferRequest struct {
+	BatchID string   `json:"batch_id"`
+	Date    string   `json:"date"`    // 2006-01-02, first day in the new batch, default today
+	Fee     *float64 `json:"fee"`     // leave out to keep the old fee, 0 for the new batch's
+	Class   string   `json:"class"`   // defaults to the new batch's
+	Subject string   `json:"subject"` // defaults to the new batch's
+	Prorate *bool    `json:"prorate"` // split the month's fee by days, default PRORATE_TRANSFERS
+}
+
+// TransferEnrolment moves a student to another batch, e.g. for a new time
+// or level. The old enrolment ends the day before the new one starts and
+// the two are linked, so the student's history shows where they were.
+func TransferEnrolment(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Date == "" {
+		req.Date = time.Now().Format(dateLayout)
+	}
+	day, err := time.Parse(dateLayout, req.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	if req.Fee != nil && *req.Fee < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "fee cannot be negative"})
+	}
+	batchID, err := primitive.ObjectIDFromHex(req.BatchID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid batch ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var from models.Enrolment
+	if err := database.DB.Collection("enrolments").FindOne(ctx, bson.M{"_id": objID}).Decode(&from); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Enrolment not found"})
+	}
+	if from.Status != models.EnrolmentActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Enrolment has already ended"})
+	}
+	if from.BatchID == req.BatchID {
+		return c.Status(400).JSON(fiber.Map{"error": "Already in this batch"})
+	}
+	if req.Date <= from.Start {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be after the enrolment started"})
+	}
+
+	var batch models.Batch
+	if err := database.DB.Collection("batches").FindOne(ctx, bson.M{"_id": batchID}).Decode(&batch); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+	already, err := database.DB.Collection("enrolments").CountDocuments(ctx, bson.M{
+		"student_id": from.StudentID,
+		"batch_id":   req.BatchID,
+		"status":     models.EnrolmentActive,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch enrolments"})
+	}
+	if already > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Student is already in this batch"})
+	}
+
+	prorate := os.Getenv("PRORATE_TRANSFERS") == "true"
+	if req.Prorate != nil {
+		prorate = *req.Prorate
+	}
+
+	// A month already paid in full for the old batch can't be split after
+	// the fact, the new batch would charge its share on top
+	if month := day.Format(monthLayout); prorate && day.Day() > 1 {
+		paid, err := paidEnrolments(ctx, month, from.StudentID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payments"})
+		}
+		// Payments from before enrolments don't say which one they paid
+		whole, err := database.DB.Collection("payments").CountDocuments(ctx, bson.M{
+			"student_id": from.StudentID,
+			"months":     month,
+			"void":       false,
+			"lines":      bson.M{"$not": bson.M{"$elemMatch": bson.M{"enrolment_id": bson.M{"$exists": true}}}},
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payments"})
+		}
+		if paid[from.ID.Hex()] || whole > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": month + " is already paid for the old batch, transfer without prorate"})
+		}
+	}
+	to := models.Enrolment{
+		ID:              primitive.NewObjectID(),
+		StudentID:       from.StudentID,
+		BatchID:         req.BatchID,
+		BatchTime:       batchLabel(batch),
+		Class:           strings.TrimSpace(req.Class),
+		Subject:         strings.TrimSpace(req.Subject),
+		Fee:             from.Fee,
+		Status:          models.EnrolmentActive,
+		Start:           req.Date,
+		CreatedAt:       time.Now(),
+		TransferredFrom: from.ID.Hex(),
+		Prorate:         prorate,
+	}
+	if req.Fee != nil {
+		to.Fee = round2(*req.Fee)
+	}
+	if to.Class == "" {
+		to.Class = batch.Class
+	}
+	if to.Subject == "" {
+		to.Subject = batch.Subject
+	}
+
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := endEnrolment(sc, &from, day.AddDate(0, 0, -1).Format(dateLayout)); err != nil {
+			return err
+		}
+		_, err := database.DB.Collection("enrolments").UpdateByID(sc, from.ID, bson.M{"$set": bson.M{
+			"transferred_to": to.ID.Hex(),
+			"prorate":        prorate,
+		}})
+		if err != nil {
+			return err
+		}
+		if err := insertEnrolment(sc, to); err != nil {
+			return err
+		}
+		studentID, err := primitive.ObjectIDFromHex(from.StudentID)
+		if err != nil {
+			return err
+		}
+		return syncStudentBatch(sc, studentID)
+	})
+	if errors.Is(err, errEnrolmentEnded) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Enrolment has already ended"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to transfer student"})
+	}
+	from.TransferredTo, from.Prorate = to.ID.Hex(), prorate
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"from": from, "to": to})
+}
+
+// PayEnrolment takes the fee of one enrolment on its own:
+// {"month": "2006-01", "method": "bkash", ...}, the month defaulting to
+// this one. Late fees are left for the whole-month payment. Once every
+// enrolment is paid the month is marked paid on the student.
+func PayEnrolment(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Month string `json:"month"`
+		PaymentMethod
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+	if req.Month == "" {
+		req.Month = time.Now().Format(monthLayout)
+	}
+	if _, _, err := monthBounds(req.Month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+	if err := req.PaymentMethod.normalize(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var e models.Enrolment
+	if err := database.DB.Collection("enrolments").FindOne(ctx, bson.M{"_id": objID}).Decode(&e); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Enrolment not found"})
+	}
+	if !enrolledDuring(e, req.Month) {
+		return c.Status(400).JSON(fiber.Map{"error": "Not enrolled in " + req.Month})
+	}
+	if !chargedFor(e, req.Month) {
+		return c.Status(400).JSON(fiber.Map{"error": req.Month + " is charged to the batch they moved from"})
+	}
+	student, status, err := findStudent(ctx, e.StudentID)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	paid, err := paidEnrolments(ctx, req.Month, e.StudentID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payments"})
+	}
+	if paid[e.ID.Hex()] {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already paid for " + req.Month})
+	}
+
+	locked, err := dayLocked(ctx, c, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check day close"})
+	}
+	if locked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Today is closed, ask an admin"})
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+	lines, err := applyCredits(ctx, e.StudentID, []models.PaymentLine{feeLine(req.Month, fees.enrolmentFee(*student, e, req.Month))})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+
+	// The payment belongs to this enrolment's batch
+	payer := *student
+	payer.BatchID, payer.BatchTime, payer.Class, payer.Subject = e.BatchID, e.BatchTime, e.Class, e.Subject
+	// Checked again inside the transaction: two counters taking the same
+	// fee both bump the receipt counter, so the later one is retried and
+	// sees the first payment
+	payment := newPayment(payer, []string{req.Month}, lines, req.PaymentMethod, auth.CurrentUser(c))
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		paid, err := paidEnrolments(sc, req.Month, e.StudentID)
+		if err != nil {
+			return err
+		}
+		if paid[e.ID.Hex()] {
+			return errAlreadyPaid
+		}
+		return savePayment(sc, payment)
+	})
+	if errors.Is(err, errAlreadyPaid) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already paid for " + req.Month})
+	}
+	if errors.Is(err, errDuplicateTransaction) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This " + req.Method + " transaction ID was already used for another payment"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record payment"})
+	}
+
+	paid[e.ID.Hex()] = true
+	all := true
+	for _, other := range fees.enrolments[e.StudentID] {
+		if chargedFor(other, req.Month) && !paid[other.ID.Hex()] {
+			all = false
+		}
+	}
+	if all {
+		if err := markMonthPaid(ctx, *student, req.Month); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update student"})
+		}
+	}
+
+	notifyPayment(payer, payment.ReceiptNo)
+
+	return c.Status(fiber.StatusCreated).JSON(payment)
+}
+
+// MigrateEnrolments gives every student without enrolments one for the
+// batch on their record, and recounts the students of each batch. It runs
+// at startup and does nothing once every student has been moved over.
+func MigrateEnrolments() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	enrolled, err := database.DB.Collection("enrolments").Distinct(ctx, "student_id", bson.M{})
+	if err != nil {
+		log.Println("❌ Failed to migrate enrolments:", err)
+		return
+	}
+	done := map[string]bool{}
+	for _, id := range enrolled {
+		if s, ok := id.(string); ok {
+			done[s] = true
+		}
+	}
+
+	var students []models.Student
+	if err := findAll(ctx, "students", bson.M{}, &students); err != nil {
+		log.Println("❌ Failed to migrate enrolments:", err)
+		return
+	}
+
+	var docs []interface{}
+	for _, s := range students {
+		if done[s.ID.Hex()] || (s.BatchID == "" && s.BatchTime == "" && s.Subject == "") {
+			continue
+		}
+		docs = append(docs, legacyEnrolment(s, ""))
+	}
+	if len(docs) == 0 {
+		return
+	}
+
+	if _, err := database.DB.Collection("enrolments").InsertMany(ctx, docs); err != nil {
+		log.Println("❌ Failed to migrate enrolments:", err)
+		return
+	}
+	if err := recountBatches(ctx); err != nil {
+		log.Println("❌ Failed to recount batches:", err)
+	}
+	log.Printf("Moved %d students over to enrolments", len(docs))
+}
+
+// legacyEnrolment is the enrolment a student's own batch fields describe.
+// Its fee is left to the batch, falling back to the student's
+// payment_amount as before.
+func legacyEnrolment(s models.Student, start string) models.Enrolment {
+	return models.Enrolment{
+		ID:        primitive.NewObjectID(),
+		StudentID: s.ID.Hex(),
+		BatchID:   s.BatchID,
+		BatchTime: s.BatchTime,
+		Class:     s.Class,
+		Subject:   s.Subject,
+		Status:    models.EnrolmentActive,
+		Start:     start,
+		CreatedAt: time.Now(),
+	}
+}
+
+var errEnrolmentEnded = errors.New("enrolment already ended")
+
+// insertEnrolment saves a new enrolment and counts the student in its batch
+func insertEnrolment(ctx context.Context, e models.Enrolment) error {
+	if _, err := database.DB.Collection("enrolments").InsertOne(ctx, e); err != nil {
+		return err
+	}
+	return countInBatch(ctx, e.BatchID, 1)
+}
+
+// endEnrolment closes an active enrolment on its last day and takes the
+// student off the batch count
+func endEnrolment(ctx context.Context, e *models.Enrolment, end string) error {
+	res, err := database.DB.Collection("enrolments").UpdateOne(ctx,
+		bson.M{"_id": e.ID, "status": models.EnrolmentActive},
+		bson.M{"$set": bson.M{"status": models.EnrolmentEnded, "end": end}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errEnrolmentEnded
+	}
+	e.Status, e.End = models.EnrolmentEnded, end
+	return countInBatch(ctx, e.BatchID, -1)
+}
+
+func countInBatch(ctx context.Context, batchID string, n int) error {
+	objID, err := primitive.ObjectIDFromHex(batchID)
+	if err != nil {
+		return nil // not a managed batch
+	}
+	_, err = database.DB.Collection("batches").UpdateByID(ctx, objID, bson.M{"$inc": bson.M{"total_students": n}})
+	return err
+}
+
+// recountBatches sets every batch's total_students to its active enrolments
+func recountBatches(ctx context.Context) error {
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, b := range batches {
+		n, err := database.DB.Collection("enrolments").CountDocuments(ctx, bson.M{"batch_id": b.ID.Hex(), "status": models.EnrolmentActive})
+		if err != nil {
+			return err
+		}
+		if _, err := database.DB.Collection("batches").UpdateByID(ctx, b.ID, bson.M{"$set": bson.M{"total_students": n}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncStudentBatch copies the first active enrolment onto the student's
+// own batch fields, which the older screens and reports still read
+func syncStudentBatch(ctx context.Context, studentID primitive.ObjectID) error {
+	opts := options.FindOne().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "created_at", Value: 1}})
+	var e models.Enrolment
+	err := database.DB.Collection("enrolments").FindOne(ctx,
+		bson.M{"student_id": studentID.Hex(), "status": models.EnrolmentActive}, opts).Decode(&e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Collection("students").UpdateByID(ctx, studentID, bson.M{"$set": bson.M{
+		"batch_id":   e.BatchID,
+		"batch_time": e.BatchTime,
+		"class":      e.Class,
+		"subject":    e.Subject,
+	}})
+	return err
+}
+
+// loadEnrolments finds enrolments, oldest first
+func loadEnrolments(ctx context.Context, filter bson.M) ([]models.Enrolment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := database.DB.Collection("enrolments").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	enrolments := []models.Enrolment{}
+	if err := cursor.All(ctx, &enrolments); err != nil {
+		return nil, err
+	}
+	return enrolments, nil
+}
+
+// enrolledDuring reports whether an enrolment covers any of a period, a
+// month (2006-01) or a day (2006-01-02)
+func enrolledDuring(e models.Enrolment, period string) bool {
+	if e.Start != "" && e.Start[:min(len(period), len(e.Start))] > period {
+		return false
+	}
+	if e.End != "" && e.End[:min(len(period), len(e.End))] < period {
+		return false
+	}
+	return true
+}
+
+// chargedFor reports whether an enrolment is charged a fee for a month.
+// The month a student moves in on is left to the batch they moved from
+// unless the transfer is prorated.
+func chargedFor(e models.Enrolment, month string) bool {
+	if !enrolledDuring(e, month) {
+		return false
+	}
+	share, _ := transferShare(e, month)
+	return share > 0
+}
+
+// transferShare is the part of a month's fee an enrolment carries, and
+// the days it is charged for, when a transfer in or out of it falls inside
+// the month. Without proration the enrolment moved from keeps the whole
+// month.
+func transferShare(e models.Enrolment, month string) (float64, int) {
+	start, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return 1, 0
+	}
+	total := start.AddDate(0, 1, -1).Day()
+
+	first, last := 1, total
+	if e.TransferredFrom != "" && strings.HasPrefix(e.Start, month) {
+		if d, err := time.Parse(dateLayout, e.Start); err == nil {
+			first = d.Day()
+		}
+	}
+	if e.TransferredTo != "" && strings.HasPrefix(e.End, month) {
+		if d, err := time.Parse(dateLayout, e.End); err == nil {
+			last = d.Day()
+		}
+	}
+
+	days := last - first + 1
+	switch {
+	case days >= total:
+		return 1, 0
+	case days <= 0:
+		return 0, 0
+	case !e.Prorate && first > 1:
+		return 0, 0
+	case !e.Prorate:
+		return 1, 0
+	}
+	return float64(days) / float64(total), days
+}
+
+// enrolledStudents lists the students enrolled in a batch on a day
+// (2006-01-02), by name
+func enrolledStudents(ctx context.Context, batchID, day string) ([]models.Student, error) {
+	enrolments, err := loadEnrolments(ctx, bson.M{"batch_id": batchID})
+	if err != nil {
+		return nil, err
+	}
+	ids := []primitive.ObjectID{}
+	for _, e := range enrolments {
+		if !enrolledDuring(e, day) {
+			continue
+		}
+		if id, err := primitive.ObjectIDFromHex(e.StudentID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	var students []models.Student
+	if err := findAll(ctx, "students", bson.M{"_id": bson.M{"$in": ids}}, &students); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(students, func(i, j int) bool { return students[i].Name < students[j].Name })
+	return students, nil
+}
+
+// paidEnrolments is the set of enrolments whose fee for a month is on a
+// payment that isn't void, for one student or everyone when studentID is
+// empty
+func paidEnrolments(ctx context.Context, month, studentID string) (map[string]bool, error) {
+	filter := bson.M{"months": month, "void": false, "lines.enrolment_id": bson.M{"$exists": true}}
+	if studentID != "" {
+		filter["student_id"] = studentID
+	}
+	var payments []models.Payment
+	if err := findAll(ctx, "payments", filter, &payments); err != nil {
+		return nil, err
+	}
+
+	paid := map[string]bool{}
+	for _, p := range payments {
+		for _, l := range p.Lines {
+			if l.Kind == models.LineFee && l.EnrolmentID != "" {
+				paid[l.EnrolmentID] = true
+			}
+		}
+	}
+	return paid, nil
+}
+
+func findStudent(ctx context.Context, id string) (*models.Student, int, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, 400, errors.New("Invalid ID")
+	}
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student); err != nil {
+		return nil, 404, errors.New("Student not found")
+	}
+	return &student, 200, nil
+}
+
+// batchLabel is what goes in a student's batch_time for a batch
+func batchLabel(b models.Batch) string {
+	if b.BatchName != "" {
+		return b.BatchName
+	}
+	return b.Time
+}
+
+// correctFirstEnrolment applies a change to a student's class or subject,
+// made through UpdateStudent, to the enrolment they mirror
+func correctFirstEnrolment(ctx context.Context, studentID primitive.ObjectID, update bson.M) error {
+	opts := options.FindOne().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "created_at", Value: 1}})
+	var e models.Enrolment
+	err := database.DB.Collection("enrolments").FindOne(ctx,
+		bson.M{"student_id": studentID.Hex(), "status": models.EnrolmentActive}, opts).Decode(&e)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Collection("enrolments").UpdateByID(ctx, e.ID, bson.M{"$set": update})
+	return err
+}
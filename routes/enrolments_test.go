@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dishan1223/cms/models"
+)
+
+func TestTransferShare(t *testing.T) {
+	in := func(start string, prorate bool) models.Enrolment {
+		return models.Enrolment{Start: start, TransferredFrom: "old", Prorate: prorate}
+	}
+	out := func(end string, prorate bool) models.Enrolment {
+		return models.Enrolment{Start: "2025-01-01", End: end, TransferredTo: "new", Prorate: prorate}
+	}
+
+	tests := []struct {
+		name      string
+		enrolment models.Enrolment
+		month     string
+		share     float64
+		days      int
+	}{
+		{"no transfer", models.Enrolment{Start: "2025-04-11"}, "2025-04", 1, 0},
+		{"moved in mid-month, prorated", in("2025-04-11", true), "2025-04", 20.0 / 30, 20},
+		{"moved in mid-month, not prorated", in("2025-04-11", false), "2025-04", 0, 0},
+		{"moved in on the 1st", in("2025-04-01", false), "2025-04", 1, 0},
+		{"moved in on the 1st, prorated", in("2025-04-01", true), "2025-04", 1, 0},
+		{"moved in on the last day, prorated", in("2025-04-30", true), "2025-04", 1.0 / 30, 1},
+		{"month after moving in", in("2025-04-11", false), "2025-05", 1, 0},
+		{"moved out mid-month, prorated", out("2025-04-10", true), "2025-04", 10.0 / 30, 10},
+		{"moved out mid-month, not prorated", out("2025-04-10", false), "2025-04", 1, 0},
+		{"moved out on the last day", out("2025-04-30", true), "2025-04", 1, 0},
+		{"leap February, prorated", in("2024-02-15", true), "2024-02", 15.0 / 29, 15},
+		{
+			"in and out in one month, prorated",
+			models.Enrolment{Start: "2025-04-11", End: "2025-04-20", TransferredFrom: "a", TransferredTo: "b", Prorate: true},
+			"2025-04", 10.0 / 30, 10,
+		},
+		{"bad month", in("2025-04-11", true), "April", 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share, days := transferShare(tt.enrolment, tt.month)
+			if math.Abs(share-tt.share) > 1e-9 || days != tt.days {
+				t.Errorf("transferShare() = %v, %v, want %v, %v", share, days, tt.share, tt.days)
+			}
+		})
+	}
+}
+
+func TestChargedFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		enrolment models.Enrolment
+		month     string
+		want      bool
+	}{
+		{"before the start", models.Enrolment{Start: "2025-04-11"}, "2025-03", false},
+		{"after the end", models.Enrolment{Start: "2025-01-01", End: "2025-03-31"}, "2025-04", false},
+		{"moved in, not prorated", models.Enrolment{Start: "2025-04-11", TransferredFrom: "old"}, "2025-04", false},
+		{"moved in, prorated", models.Enrolment{Start: "2025-04-11", TransferredFrom: "old", Prorate: true}, "2025-04", true},
+		{"enrolled from before records", models.Enrolment{}, "2025-04", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chargedFor(tt.enrolment, tt.month); got != tt.want {
+				t.Errorf("chargedFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
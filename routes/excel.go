@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/dishan1223/cms/database"
@@ -33,28 +32,50 @@ func ExportStudents(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to parse students"})
 	}
 
-	// Group students by BatchTime
-	batchMap := make(map[string][]models.Student)
-	for _, s := range students {
-		batchMap[s.BatchTime] = append(batchMap[s.BatchTime], s)
+	// Fees after discounts, with the reason for any difference
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to work out fees"})
+	}
+	feeMonth := time.Now().Format(monthLayout)
+	paid, err := paidEnrolments(ctx, feeMonth, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch payments"})
 	}
 
-	// Week order map
-	weekOrder := map[string]int{
-		"Saturday":  0,
-		"Sunday":    1,
-		"Monday":    2,
-		"Tuesday":   3,
-		"Wednesday": 4,
-		"Thursday":  5,
-		"Friday":    6,
+	// One row per enrolment on the sheet of its batch, grouped by BatchTime.
+	// Students without enrolments go on the sheet of the batch on their record.
+	enrolments := make(map[string]models.Enrolment)
+	for _, list := range fees.enrolments {
+		for _, e := range list {
+			enrolments[e.ID.Hex()] = e
+		}
+	}
+	batchMap := make(map[string][]models.Student)
+	for _, s := range students {
+		fee := fees.fee(s, feeMonth)
+		if fee.Parts == nil {
+			s.Fee = fee
+			batchMap[s.BatchTime] = append(batchMap[s.BatchTime], s)
+			continue
+		}
+		for _, part := range fee.Parts {
+			e := enrolments[part.EnrolmentID]
+			row := s
+			row.Class, row.Subject, row.BatchTime = e.Class, e.Subject, e.BatchTime
+			row.PaymentStatus = s.PaymentStatus || paid[part.EnrolmentID]
+			if e.Fee > 0 {
+				row.PaymentAmount = e.Fee
+			}
+			row.Fee = part
+			batchMap[e.BatchTime] = append(batchMap[e.BatchTime], row)
+		}
 	}
 
-	// Study day mappings
-	studyDayMap := map[string]string{
-		"smw":     "Saturday, Monday, Wednesday",
-		"stt":     "Saturday, Tuesday, Thursday",
-		"regular": "Regular",
+	// Study day patterns, shared with results and schedules
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch study days"})
 	}
 
 	// Create Excel file
@@ -62,31 +83,16 @@ func ExportStudents(c *fiber.Ctx) error {
 	firstSheet := true
 
 	for batch, batchStudents := range batchMap {
+		// Sort students by first study day, every-day patterns like "Regular" stay at the end
+		sort.SliceStable(batchStudents, func(i, j int) bool {
+			return patterns.FirstDay(batchStudents[i].StudyDays) < patterns.FirstDay(batchStudents[j].StudyDays)
+		})
+
 		// Map StudyDays codes to full names
 		for i := range batchStudents {
-			code := strings.ToLower(batchStudents[i].StudyDays)
-			if full, ok := studyDayMap[code]; ok {
-				batchStudents[i].StudyDays = full
-			}
+			batchStudents[i].StudyDays = patterns.Label(batchStudents[i].StudyDays)
 		}
 
-		// Sort students by first study day, except "Regular" stays at the end
-		sort.Slice(batchStudents, func(i, j int) bool {
-			iDays := batchStudents[i].StudyDays
-			jDays := batchStudents[j].StudyDays
-
-			if iDays == "Regular" {
-				return false
-			}
-			if jDays == "Regular" {
-				return true
-			}
-
-			iFirst := strings.Split(iDays, ",")[0]
-			jFirst := strings.Split(jDays, ",")[0]
-			return weekOrder[iFirst] < weekOrder[jFirst]
-		})
-
 		sheetName := batch
 		if firstSheet {
 			f.SetSheetName(f.GetSheetName(0), sheetName)
@@ -96,7 +102,7 @@ func ExportStudents(c *fiber.Ctx) error {
 		}
 
 		// Write headers
-		headers := []string{"Name", "Phone Number", "Class", "Subject", "Payment Status", "Payment Amount", "Study Days"}
+		headers := []string{"Name", "Phone Number", "Class", "Subject", "Payment Status", "Payment Amount", "Study Days", "Base Fee", "Discounts", "Effective Fee"}
 		for i, h := range headers {
 			col := string(rune('A' + i))
 			f.SetCellValue(sheetName, col+"1", h)
@@ -120,8 +126,14 @@ func ExportStudents(c *fiber.Ctx) error {
 			f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), s.Class)
 			f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), s.Subject)
 			f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), paymentStatus)
+			// Payment Amount is the stored fee so the sheet imports back as it
+			// was; what is charged after discounts goes in Effective Fee
+			fee := s.Fee
 			f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), s.PaymentAmount)
 			f.SetCellValue(sheetName, fmt.Sprintf("G%d", row), s.StudyDays)
+			f.SetCellValue(sheetName, fmt.Sprintf("H%d", row), fee.Base)
+			f.SetCellValue(sheetName, fmt.Sprintf("I%d", row), discountReason(fee))
+			f.SetCellValue(sheetName, fmt.Sprintf("J%d", row), fee.Effective)
 		}
 	}
 
@@ -0,0 +1,343 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExpenseRequest is the body of POST/PATCH /api/expenses. It can be sent as
+// JSON, or as a multipart form when receipts are attached.
+type ExpenseRequest struct {
+	Date        string  `json:"date" form:"date"`
+	Category    string  `json:"category" form:"category"`
+	Description string  `json:"description" form:"description"`
+	Amount      float64 `json:"amount" form:"amount"`
+}
+
+// GetExpenses lists expenses, optionally within ?from=&to= (YYYY-MM-DD)
+// and for one ?category=
+func GetExpenses(c *fiber.Ctx) error {
+	filter := bson.M{}
+	dateRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		dateRange["$gte"] = from
+	}
+	if to := c.Query("to"); to != "" {
+		dateRange["$lte"] = to
+	}
+	if len(dateRange) > 0 {
+		filter["date"] = dateRange
+	}
+	if category := c.Query("category"); category != "" {
+		filter["category"] = category
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: -1}, {Key: "created_at", Value: -1}})
+	cursor, err := database.DB.Collection("expenses").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch expenses"})
+	}
+
+	expenses := []models.Expense{}
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse expenses"})
+	}
+
+	total := 0.0
+	for _, e := range expenses {
+		total += e.Amount
+	}
+	return c.JSON(fiber.Map{"expenses": expenses, "total": round2(total)})
+}
+
+// AddExpense records an expense. Files sent in the "attachments" form
+// field are kept with it.
+func AddExpense(c *fiber.Ctx) error {
+	var req ExpenseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse request"})
+	}
+	if err := validateExpense(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	expense := models.Expense{
+		ID:          primitive.NewObjectID(),
+		Date:        req.Date,
+		Category:    req.Category,
+		Description: req.Description,
+		Amount:      req.Amount,
+		RecordedBy:  auth.CurrentUser(c),
+		CreatedAt:   time.Now(),
+	}
+
+	attachments, err := saveAttachments(ctx, c)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attachments"})
+	}
+	expense.Attachments = attachments
+
+	if _, err := database.DB.Collection("expenses").InsertOne(ctx, expense); err != nil {
+		deleteAttachments(ctx, attachments)
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert expense"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(expense)
+}
+
+// UpdateExpense corrects an expense's details; attachments are added with
+// AddExpenseAttachments
+func UpdateExpense(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("expenses")
+	var expense models.Expense
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&expense); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Expense not found"})
+	}
+
+	// Start from the stored values so missing fields stay as they are
+	req := ExpenseRequest{Date: expense.Date, Category: expense.Category, Description: expense.Description, Amount: expense.Amount}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse request"})
+	}
+	if err := validateExpense(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	expense.Date = req.Date
+	expense.Category = req.Category
+	expense.Description = req.Description
+	expense.Amount = req.Amount
+
+	update := bson.M{"$set": bson.M{
+		"date":        expense.Date,
+		"category":    expense.Category,
+		"description": expense.Description,
+		"amount":      expense.Amount,
+	}}
+	if _, err := collection.UpdateByID(ctx, objID, update); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update expense"})
+	}
+	return c.JSON(expense)
+}
+
+// DeleteExpense removes an expense and its attachments
+func DeleteExpense(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var expense models.Expense
+	if err := database.DB.Collection("expenses").FindOneAndDelete(ctx, bson.M{"_id": objID}).Decode(&expense); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Expense not found"})
+	}
+	deleteAttachments(ctx, expense.Attachments)
+
+	return c.JSON(fiber.Map{"success": true, "message": "Expense deleted successfully"})
+}
+
+// AddExpenseAttachments attaches more files to an existing expense
+func AddExpenseAttachments(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("expenses")
+	if count, err := collection.CountDocuments(ctx, bson.M{"_id": objID}); err != nil || count == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Expense not found"})
+	}
+
+	attachments, err := saveAttachments(ctx, c)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save attachments"})
+	}
+	if len(attachments) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "attachments are required"})
+	}
+
+	update := bson.M{"$push": bson.M{"attachments": bson.M{"$each": attachments}}}
+	if _, err := collection.UpdateByID(ctx, objID, update); err != nil {
+		deleteAttachments(ctx, attachments)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update expense"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(attachments)
+}
+
+// GetExpenseAttachment downloads one attachment of an expense
+func GetExpenseAttachment(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	fileID, err := primitive.ObjectIDFromHex(c.Params("fileId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid file ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var expense models.Expense
+	if err := database.DB.Collection("expenses").FindOne(ctx, bson.M{"_id": objID, "attachments.file_id": fileID}).Decode(&expense); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	var attachment models.Attachment
+	for _, a := range expense.Attachments {
+		if a.FileID == fileID {
+			attachment = a
+		}
+	}
+
+	bucket, err := expenseBucket()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot open file store"})
+	}
+	stream, err := bucket.OpenDownloadStream(fileID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	defer stream.Close()
+
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read attachment"})
+	}
+
+	// Only receipts we know are safe to show open in the browser, anything
+	// else (HTML, SVG) could run script on our origin
+	contentType, disposition := "application/octet-stream", "attachment"
+	if inlineAttachmentTypes[attachment.ContentType] {
+		contentType, disposition = attachment.ContentType, "inline"
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, strings.ReplaceAll(attachment.Filename, `"`, "")))
+	c.Set("X-Content-Type-Options", "nosniff")
+	return c.Send(data)
+}
+
+var inlineAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"application/pdf": true,
+}
+
+// validateExpense checks an expense request and tidies its fields
+func validateExpense(req *ExpenseRequest) error {
+	if _, err := time.Parse(dateLayout, req.Date); err != nil {
+		return fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	if req.Amount <= 0 {
+		return fmt.Errorf("amount must be more than 0")
+	}
+
+	req.Category = strings.ToLower(strings.TrimSpace(req.Category))
+	for _, category := range models.ExpenseCategories {
+		if req.Category == category {
+			req.Description = strings.TrimSpace(req.Description)
+			return nil
+		}
+	}
+	return fmt.Errorf("category must be one of %s", strings.Join(models.ExpenseCategories, ", "))
+}
+
+// Receipts and bills live in GridFS as expense_files
+func expenseBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(database.DB, options.GridFSBucket().SetName("expense_files"))
+}
+
+// saveAttachments stores the files of the "attachments" form field. A JSON
+// request has none.
+func saveAttachments(ctx context.Context, c *fiber.Ctx) ([]models.Attachment, error) {
+	attachments := []models.Attachment{}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return attachments, nil
+	}
+
+	bucket, err := expenseBucket()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fh := range form.File["attachments"] {
+		attachment, err := uploadAttachment(bucket, fh)
+		if err != nil {
+			deleteAttachments(ctx, attachments)
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func uploadAttachment(bucket *gridfs.Bucket, fh *multipart.FileHeader) (models.Attachment, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	defer file.Close()
+
+	contentType := fh.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	fileID := primitive.NewObjectID()
+	opts := options.GridFSUpload().SetMetadata(bson.M{"content_type": contentType})
+	if err := bucket.UploadFromStreamWithID(fileID, fh.Filename, file, opts); err != nil {
+		return models.Attachment{}, err
+	}
+
+	return models.Attachment{
+		FileID:      fileID,
+		Filename:    filepath.Base(fh.Filename),
+		ContentType: contentType,
+		Size:        fh.Size,
+	}, nil
+}
+
+func deleteAttachments(ctx context.Context, attachments []models.Attachment) {
+	bucket, err := expenseBucket()
+	if err != nil {
+		return
+	}
+	for _, a := range attachments {
+		bucket.DeleteContext(ctx, a.FileID)
+	}
+}
@@ -0,0 +1,309 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddHolidayRequest is the body of POST /api/holidays
+type AddHolidayRequest struct {
+	Date       string `json:"date"`
+	BatchID    string `json:"batch_id"` // empty for the whole centre
+	Reason     string `json:"reason"`
+	MakeUpDate string `json:"make_up_date"`
+	// Silent skips the SMS to affected students
+	Silent bool `json:"silent"`
+}
+
+// holidays indexes holiday entries for quick lookups by batch and date
+type holidays []models.Holiday
+
+// GetHolidays lists holidays and cancellations, optionally within
+// ?from=&to= and for one ?batch_id= (centre-wide days are always included)
+func GetHolidays(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	list, err := loadHolidays(ctx, c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch holidays"})
+	}
+
+	if batchID := c.Query("batch_id"); batchID != "" {
+		filtered := holidays{}
+		for _, h := range list {
+			if h.BatchID == "" || h.BatchID == batchID {
+				filtered = append(filtered, h)
+			}
+		}
+		list = filtered
+	}
+
+	return c.JSON(list)
+}
+
+// AddHoliday records a centre holiday or a cancelled class and lets the
+// affected students know
+func AddHoliday(c *fiber.Ctx) error {
+	var req AddHolidayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	if _, err := time.Parse(dateLayout, req.Date); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+	if req.MakeUpDate != "" {
+		if _, err := time.Parse(dateLayout, req.MakeUpDate); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "make_up_date must be YYYY-MM-DD"})
+		}
+		if req.BatchID == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "make-up classes are set per batch"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	holiday := models.Holiday{
+		ID:         primitive.NewObjectID(),
+		Date:       req.Date,
+		BatchID:    req.BatchID,
+		Kind:       models.HolidayCentre,
+		Reason:     req.Reason,
+		MakeUpDate: req.MakeUpDate,
+		CreatedAt:  time.Now(),
+	}
+
+	if req.BatchID != "" {
+		holiday.Kind = models.HolidayCancelled
+		if batchName(ctx, req.BatchID) == "" {
+			return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+		}
+	}
+
+	collection := database.DB.Collection("holidays")
+	count, err := collection.CountDocuments(ctx, bson.M{"date": req.Date, "batch_id": req.BatchID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check holidays"})
+	}
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Already marked for this day"})
+	}
+
+	if _, err := collection.InsertOne(ctx, holiday); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert holiday"})
+	}
+
+	if !req.Silent {
+		go notifyHoliday(holiday)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(holiday)
+}
+
+// SetMakeUpClass schedules (or moves) the make-up class of a cancelled day
+func SetMakeUpClass(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		MakeUpDate string `json:"make_up_date"`
+		Silent     bool   `json:"silent"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if _, err := time.Parse(dateLayout, req.MakeUpDate); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "make_up_date must be YYYY-MM-DD"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("holidays")
+	var holiday models.Holiday
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&holiday); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Holiday not found"})
+	}
+	if holiday.BatchID == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "make-up classes are set per batch"})
+	}
+
+	holiday.MakeUpDate = req.MakeUpDate
+	if _, err := collection.UpdateByID(ctx, objID, bson.M{"$set": bson.M{"make_up_date": holiday.MakeUpDate}}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update holiday"})
+	}
+
+	if !req.Silent {
+		go notifyHoliday(holiday)
+	}
+
+	return c.JSON(holiday)
+}
+
+// DeleteHoliday removes a holiday, putting the class back on
+func DeleteHoliday(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("holidays").DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete holiday"})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Holiday not found"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Holiday deleted successfully"})
+}
+
+// loadHolidays fetches entries whose date or make-up date falls in the
+// range; empty bounds are open
+func loadHolidays(ctx context.Context, from, to string) (holidays, error) {
+	dateRange := bson.M{}
+	if from != "" {
+		dateRange["$gte"] = from
+	}
+	if to != "" {
+		dateRange["$lte"] = to
+	}
+
+	filter := bson.M{}
+	if len(dateRange) > 0 {
+		filter["$or"] = bson.A{bson.M{"date": dateRange}, bson.M{"make_up_date": dateRange}}
+	}
+
+	opts := options.Find().SetSort(bson.M{"date": 1})
+	cursor, err := database.DB.Collection("holidays").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	list := holidays{}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Off returns the entry that cancels the batch's class on date, if any
+func (hs holidays) Off(batchID, date string) *models.Holiday {
+	for i, h := range hs {
+		if h.Date == date && (h.BatchID == "" || h.BatchID == batchID) {
+			return &hs[i]
+		}
+	}
+	return nil
+}
+
+// MakeUp reports whether the batch has a make-up class on date
+func (hs holidays) MakeUp(batchID, date string) bool {
+	for _, h := range hs {
+		if h.BatchID == batchID && h.MakeUpDate == date {
+			return true
+		}
+	}
+	return false
+}
+
+// Exceptions lists the dates the batch's classes are off
+func (hs holidays) Exceptions(batchID string) []string {
+	var dates []string
+	for _, h := range hs {
+		if h.BatchID == "" || h.BatchID == batchID {
+			dates = append(dates, h.Date)
+		}
+	}
+	return dates
+}
+
+// MakeUps lists the batch's make-up class dates
+func (hs holidays) MakeUps(batchID string) []string {
+	var dates []string
+	for _, h := range hs {
+		if h.BatchID == batchID && h.MakeUpDate != "" {
+			dates = append(dates, h.MakeUpDate)
+		}
+	}
+	return dates
+}
+
+// notifyHoliday texts every student whose class falls on the day
+func notifyHoliday(h models.Holiday) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	date, err := time.Parse(dateLayout, h.Date)
+	if err != nil {
+		return
+	}
+
+	batches, err := allBatches(ctx)
+	if err != nil {
+		log.Println("❌ Failed to load batches for holiday notice:", err)
+		return
+	}
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		log.Println("❌ Failed to load study days for holiday notice:", err)
+		return
+	}
+
+	for _, b := range batches {
+		if h.BatchID != "" && b.ID.Hex() != h.BatchID {
+			continue
+		}
+		if h.BatchID == "" && !batchMeetsOn(b, date.Weekday()) {
+			continue
+		}
+
+		cursor, err := database.DB.Collection("students").Find(ctx, bson.M{"batch_id": b.ID.Hex()})
+		if err != nil {
+			log.Println("❌ Failed to load students for holiday notice:", err)
+			continue
+		}
+		var students []models.Student
+		if err := cursor.All(ctx, &students); err != nil {
+			continue
+		}
+
+		message := fmt.Sprintf("%s: there is no %s class on %s", centreName(), b.BatchName, date.Format("Monday, 02 January"))
+		if h.Reason != "" {
+			message += " (" + h.Reason + ")"
+		}
+		message += "."
+		if h.MakeUpDate != "" {
+			if makeUp, err := time.Parse(dateLayout, h.MakeUpDate); err == nil {
+				message += fmt.Sprintf(" The make-up class is on %s at the usual time.", makeUp.Format("Monday, 02 January"))
+			}
+		}
+
+		for _, s := range students {
+			if !patterns.Attends(s.StudyDays, date.Weekday()) {
+				continue
+			}
+			phone := s.GuardianPhone
+			if phone == "" {
+				phone = s.PhoneNumber
+			}
+			sendSMS(phone, message)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ID cards are the usual CR80 size, ten to an A4 page
+const (
+	cardWidth   = 85.6
+	cardHeight  = 54
+	cardsPerRow = 2
+	cardRows    = 5
+)
+
+// CheckInRequest is the body of POST /api/attendance/check-in
+type CheckInRequest struct {
+	Token string `json:"token"`
+}
+
+// StudentIDCard downloads one student's ID card
+func StudentIDCard(c *fiber.Ctx) error {
+	if err := auth.CheckSecret(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	pdf, err := idCardsPDF(ctx, []models.Student{student})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate ID card"})
+	}
+	return sendPDF(c, pdf, fmt.Sprintf("id_card_%s.pdf", safeFilename(student.Name)))
+}
+
+// BatchIDCards downloads the ID cards of every student in a batch
+func BatchIDCards(c *fiber.Ctx) error {
+	if err := auth.CheckSecret(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	students, err := enrolledStudents(ctx, c.Params("id"), time.Now().Format(dateLayout))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+	if len(students) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "No students in this batch"})
+	}
+
+	pdf, err := idCardsPDF(ctx, students)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate ID cards"})
+	}
+	return sendPDF(c, pdf, fmt.Sprintf("id_cards_%s.pdf", safeFilename(batchName(ctx, c.Params("id")))))
+}
+
+// CheckIn marks a student present from the token in their ID card's QR
+// code, in today's open attendance session of one of their batches
+func CheckIn(c *fiber.Ctx) error {
+	if err := auth.CheckSecret(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+	}
+	var req CheckInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	studentID, ok := studentFromCardToken(req.Token)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid ID card"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objID, _ := primitive.ObjectIDFromHex(studentID)
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	// The session can be of any batch the student is enrolled in today
+	today := time.Now().Format(dateLayout)
+	enrolments, err := loadEnrolments(ctx, bson.M{"student_id": studentID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch enrolments"})
+	}
+	batchIDs := []string{}
+	if len(enrolments) == 0 {
+		batchIDs = append(batchIDs, student.BatchID)
+	}
+	for _, e := range enrolments {
+		if enrolledDuring(e, today) {
+			batchIDs = append(batchIDs, e.BatchID)
+		}
+	}
+
+	collection := database.DB.Collection("attendance")
+	var session models.AttendanceSession
+	err = collection.FindOne(ctx, bson.M{
+		"batch_id": bson.M{"$in": batchIDs},
+		"date":     today,
+		"closed":   false,
+	}, options.FindOne().SetSort(bson.M{"created_at": -1})).Decode(&session)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "No class of this student's batch is in session"})
+	}
+
+	// Each scan is its own update, so two cards scanned at once can't
+	// overwrite each other's check-in
+	now := time.Now()
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "records": bson.M{"$elemMatch": bson.M{"student_id": studentID, "status": ""}}},
+		bson.M{"$set": bson.M{"records.$[r].status": models.AttendancePresent, "updated_at": now}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{
+			bson.M{"r.student_id": studentID, "r.status": ""},
+		}}),
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to mark attendance"})
+	}
+	if res.MatchedCount == 0 {
+		// Students added after the session was opened are not on its roster yet
+		res, err = collection.UpdateOne(ctx,
+			bson.M{"_id": session.ID, "records.student_id": bson.M{"$ne": studentID}},
+			bson.M{
+				"$push": bson.M{"records": models.AttendanceRecord{
+					StudentID: studentID,
+					Name:      student.Name,
+					Status:    models.AttendancePresent,
+				}},
+				"$set": bson.M{"updated_at": now},
+			},
+		)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to mark attendance"})
+		}
+	}
+	if res.MatchedCount == 0 {
+		if err := collection.FindOne(ctx, bson.M{"_id": session.ID}).Decode(&session); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to mark attendance"})
+		}
+		for _, r := range session.Records {
+			if r.StudentID == studentID {
+				return c.JSON(fiber.Map{"student": student.Name, "status": r.Status, "message": "Already checked in"})
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"student": student.Name, "status": models.AttendancePresent, "session_id": session.ID})
+}
+
+// The QR code holds "student:<id>.<signature>"
+func cardToken(studentID string) string {
+	return auth.SignedToken("student:" + studentID)
+}
+
+func studentFromCardToken(token string) (string, bool) {
+	payload, ok := auth.ParseToken(strings.TrimSpace(token))
+	if !ok || !strings.HasPrefix(payload, "student:") {
+		return "", false
+	}
+	id := strings.TrimPrefix(payload, "student:")
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return "", false
+	}
+	return id, true
+}
+
+// idCardsPDF lays the cards out on A4 pages with cutting borders
+func idCardsPDF(ctx context.Context, students []models.Student) (*fpdf.Fpdf, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 12, 15)
+	pdf.SetAutoPageBreak(false, 0)
+
+	batches := make(map[string]string)
+	for i, s := range students {
+		slot := i % (cardsPerRow * cardRows)
+		if slot == 0 {
+			pdf.AddPage()
+		}
+		x := 15 + float64(slot%cardsPerRow)*(cardWidth+8)
+		y := 12 + float64(slot/cardsPerRow)*(cardHeight+2)
+
+		if _, ok := batches[s.BatchID]; !ok {
+			batches[s.BatchID] = batchName(ctx, s.BatchID)
+		}
+		if err := drawIDCard(pdf, x, y, s, batches[s.BatchID]); err != nil {
+			return nil, err
+		}
+	}
+
+	return pdf, nil
+}
+
+func drawIDCard(pdf *fpdf.Fpdf, x, y float64, s models.Student, batch string) error {
+	png, err := qrcode.Encode(cardToken(s.ID.Hex()), qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+
+	pdf.Rect(x, y, cardWidth, cardHeight, "D")
+
+	pdf.SetFillColor(30, 60, 120)
+	pdf.Rect(x, y, cardWidth, 9, "F")
+	pdf.SetTextColor(255, 255, 255)
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.SetXY(x, y+1.5)
+	pdf.CellFormat(cardWidth, 6, centreName(), "", 0, "C", false, 0, "")
+	pdf.SetTextColor(0, 0, 0)
+
+	// Photo placeholder
+	pdf.Rect(x+3, y+12, 20, 24, "D")
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetXY(x+3, y+22)
+	pdf.CellFormat(20, 4, "PHOTO", "", 0, "C", false, 0, "")
+
+	if batch == "" {
+		batch = s.BatchTime
+	}
+	lines := [][2]string{{"Name", s.Name}, {"Class", s.Class}, {"Batch", batch}, {"Phone", s.PhoneNumber}}
+	for i, l := range lines {
+		pdf.SetXY(x+25, y+12+float64(i)*6)
+		pdf.SetFont("Helvetica", "B", 8)
+		pdf.CellFormat(11, 5, l[0]+":", "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(26, 5, l[1], "", 0, "L", false, 0, "")
+	}
+
+	name := "qr_" + s.ID.Hex()
+	opts := fpdf.ImageOptions{ImageType: "PNG"}
+	pdf.RegisterImageOptionsReader(name, opts, bytes.NewReader(png))
+	pdf.ImageOptions(name, x+cardWidth-27, y+12, 24, 24, false, opts, 0, "")
+
+	pdf.SetFont("Helvetica", "", 6)
+	pdf.SetXY(x+3, y+cardHeight-8)
+	pdf.CellFormat(cardWidth-6, 4, "ID: "+s.ID.Hex(), "", 0, "L", false, 0, "")
+
+	return pdf.Error()
+}
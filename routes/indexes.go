@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EnsureIndexes creates the unique indexes that keep concurrent writers
+// from inserting the same document twice. It runs at startup; creating an
+// index that exists does nothing.
+func EnsureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	indexes := map[string]mongo.IndexModel{
+		// One late fee per student and month, however many runs race
+		"late_fees": {
+			Keys:    bson.D{{Key: "student_id", Value: 1}, {Key: "month", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// Study day patterns are looked up by code
+		"study_days": {
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// One attendance session per batch and day
+		"attendance": {
+			Keys:    bson.D{{Key: "batch_id", Value: 1}, {Key: "date", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// One live invoice per student and month; a void one can be
+		// billed again. Partial filters can't use $ne, so the live
+		// statuses are listed
+		"invoices": {
+			Keys: bson.D{{Key: "student_id", Value: 1}, {Key: "month", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{
+				"status": bson.M{"$in": []string{models.InvoiceDraft, models.InvoiceIssued, models.InvoicePaid}},
+			}),
+		},
+		// One close per day, whoever closes first
+		"day_closes": {
+			Keys:    bson.D{{Key: "date", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	for collection, index := range indexes {
+		if _, err := database.DB.Collection(collection).Indexes().CreateOne(ctx, index); err != nil {
+			log.Printf("❌ Failed to index %s: %v", collection, err)
+		}
+	}
+}
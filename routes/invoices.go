@@ -0,0 +1,425 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Day of the billing month invoices fall due when no due date is given
+const invoiceDueDay = 10
+
+var errInvoiceIssued = errors.New("invoice is not a draft")
+
+// InvoiceRequest is the body of POST /api/invoices/generate
+type InvoiceRequest struct {
+	Month      string   `json:"month"` // 2006-01
+	StudentIDs []string `json:"student_ids"`
+	BatchID    string   `json:"batch_id"`
+	BillTo     string   `json:"bill_to"`  // sponsor or company, defaults to the student
+	DueDate    string   `json:"due_date"` // 2006-01-02
+	Issue      bool     `json:"issue"`    // issue straight away instead of leaving drafts
+}
+
+// GetInvoices lists invoices, optionally filtered by ?month=, ?student_id=
+// and ?status=
+func GetInvoices(c *fiber.Ctx) error {
+	filter := bson.M{}
+	for _, key := range []string{"month", "student_id", "status"} {
+		if v := c.Query(key); v != "" {
+			filter[key] = v
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "month", Value: -1}, {Key: "student_name", Value: 1}})
+	cursor, err := database.DB.Collection("invoices").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch invoices"})
+	}
+
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse invoices"})
+	}
+	return c.JSON(invoices)
+}
+
+// GenerateInvoices bills a month for the given student_ids, a batch_id, or
+// every student when neither is given. Students who already have an
+// invoice for the month that isn't void, or aren't enrolled that month,
+// are skipped.
+func GenerateInvoices(c *fiber.Ctx) error {
+	var req InvoiceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	start, _, err := monthBounds(req.Month)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+	if req.DueDate == "" {
+		req.DueDate = start.AddDate(0, 0, invoiceDueDay-1).Format(dateLayout)
+	}
+	if _, err := time.Parse(dateLayout, req.DueDate); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "due_date must be YYYY-MM-DD"})
+	}
+	req.BillTo = strings.TrimSpace(req.BillTo)
+
+	filter := bson.M{}
+	if len(req.StudentIDs) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(req.StudentIDs))
+		for _, id := range req.StudentIDs {
+			objID, err := primitive.ObjectIDFromHex(id)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Invalid student ID " + id})
+			}
+			ids = append(ids, objID)
+		}
+		filter["_id"] = bson.M{"$in": ids}
+	}
+	if req.BatchID != "" {
+		filter["batch_id"] = req.BatchID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var students []models.Student
+	if err := findAll(ctx, "students", filter, &students); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+
+	billed, err := database.DB.Collection("invoices").Distinct(ctx, "student_id", bson.M{
+		"month":  req.Month,
+		"status": bson.M{"$ne": models.InvoiceVoid},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch earlier invoices"})
+	}
+	skip := map[string]bool{}
+	for _, v := range billed {
+		if id, ok := v.(string); ok {
+			skip[id] = true
+		}
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fees"})
+	}
+
+	invoices := []models.Invoice{}
+	skipped := 0
+	user := auth.CurrentUser(c)
+	for _, s := range students {
+		if skip[s.ID.Hex()] {
+			skipped++
+			continue
+		}
+
+		lines, err := invoiceLines(ctx, fees, s, req.Month)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee for " + s.Name})
+		}
+		if lines == nil {
+			skipped++ // not charged for the month
+			continue
+		}
+		total := 0.0
+		for _, l := range lines {
+			total += l.Amount
+		}
+
+		inv := models.Invoice{
+			ID:          primitive.NewObjectID(),
+			StudentID:   s.ID.Hex(),
+			StudentName: s.Name,
+			BillTo:      req.BillTo,
+			BatchID:     s.BatchID,
+			Class:       s.Class,
+			Subject:     s.Subject,
+			Month:       req.Month,
+			Lines:       lines,
+			Total:       round2(total),
+			DueDate:     req.DueDate,
+			Status:      models.InvoiceDraft,
+			CreatedBy:   user,
+			CreatedAt:   time.Now(),
+		}
+		if inv.BillTo == "" {
+			inv.BillTo = s.Name
+		}
+
+		err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+			if req.Issue {
+				if err := issueInvoice(sc, &inv); err != nil {
+					return err
+				}
+			}
+			_, err := database.DB.Collection("invoices").InsertOne(sc, inv)
+			return err
+		})
+		if mongo.IsDuplicateKeyError(err) {
+			skipped++ // billed by a run racing this one
+			continue
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot save invoice for " + s.Name})
+		}
+		invoices = append(invoices, inv)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"month":     req.Month,
+		"generated": len(invoices),
+		"skipped":   skipped,
+		"invoices":  invoices,
+	})
+}
+
+// invoiceLines is what an invoice bills for a month: the fee after
+// discounts of each enrolment charged that month, and the late fees for it
+// that weren't waived. Payments and credit notes are settled against it
+// later, so they aren't taken off. It is nil for a student with enrolments
+// none of which is charged that month.
+func invoiceLines(ctx context.Context, fees *feeCalculator, s models.Student, month string) ([]models.PaymentLine, error) {
+	fee := fees.fee(s, month)
+	parts := fee.Parts
+	if parts == nil {
+		parts = []*models.Fee{fee}
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	lines := []models.PaymentLine{}
+	for _, part := range parts {
+		lines = append(lines, feeLine(month, part))
+	}
+
+	var lateFees []models.LateFee
+	if err := findAll(ctx, "late_fees", bson.M{"student_id": s.ID.Hex(), "month": month, "waived": false}, &lateFees); err != nil {
+		return nil, err
+	}
+	for _, lf := range lateFees {
+		lines = append(lines, models.PaymentLine{
+			Kind:        models.LineLateFee,
+			Description: lateFeeDescription(month),
+			Amount:      lf.Amount,
+			LateFeeID:   lf.ID.Hex(),
+		})
+	}
+	return lines, nil
+}
+
+// IssueInvoice numbers a draft invoice and sends it out. A month that was
+// paid in the meantime goes straight to paid.
+func IssueInvoice(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("invoices")
+	var inv models.Invoice
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := collection.FindOne(sc, bson.M{"_id": objID}).Decode(&inv); err != nil {
+			return err
+		}
+		if inv.Status != models.InvoiceDraft {
+			return errInvoiceIssued
+		}
+		if err := issueInvoice(sc, &inv); err != nil {
+			return err
+		}
+		// Only a still-draft invoice is issued, in case two people click at once
+		res, err := collection.ReplaceOne(sc, bson.M{"_id": objID, "status": models.InvoiceDraft}, inv)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errInvoiceIssued
+		}
+		return nil
+	})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(404).JSON(fiber.Map{"error": "Invoice not found"})
+	}
+	if errors.Is(err, errInvoiceIssued) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Invoice is not a draft"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue invoice"})
+	}
+
+	return c.JSON(inv)
+}
+
+// VoidInvoice cancels a draft or issued invoice: {"reason": "..."}. A paid
+// invoice is voided by voiding its payment first.
+func VoidInvoice(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "reason is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var inv models.Invoice
+	err = database.DB.Collection("invoices").FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "status": bson.M{"$in": bson.A{models.InvoiceDraft, models.InvoiceIssued}}},
+		bson.M{"$set": bson.M{"status": models.InvoiceVoid, "void_reason": req.Reason}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&inv)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Only draft and issued invoices can be voided"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to void invoice"})
+	}
+
+	return c.JSON(inv)
+}
+
+// InvoicePDF prints an invoice. Drafts, paid and void invoices are
+// stamped as such.
+func InvoicePDF(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var inv models.Invoice
+	if err := database.DB.Collection("invoices").FindOne(ctx, bson.M{"_id": objID}).Decode(&inv); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Invoice not found"})
+	}
+
+	pdf := newPDF("Invoice")
+	writeInvoice(pdf, inv, batchName(ctx, inv.BatchID))
+
+	name := inv.Number
+	if name == "" {
+		name = "draft_" + inv.ID.Hex()
+	}
+	return sendPDF(c, pdf, fmt.Sprintf("invoice_%s.pdf", safeFilename(name)))
+}
+
+// issueInvoice gives an invoice the next number of the financial year and
+// marks it issued, or paid if the month already has a payment. It is
+// called inside a transaction so a failed save doesn't use up a number.
+func issueInvoice(sc mongo.SessionContext, inv *models.Invoice) error {
+	now := time.Now()
+	year := financialYear(now)
+	seq, err := nextSequence(sc, "invoice:"+year)
+	if err != nil {
+		return err
+	}
+	inv.Number = fmt.Sprintf("INV-%s-%05d", year, seq)
+	inv.IssuedAt = &now
+	inv.Status = models.InvoiceIssued
+
+	payment, err := monthPayment(sc, inv.StudentID, inv.Month)
+	if err != nil {
+		return err
+	}
+	if payment != nil {
+		inv.Status = models.InvoicePaid
+		inv.PaymentID = payment.ID.Hex()
+		inv.ReceiptNo = payment.ReceiptNo
+		inv.PaidAt = &payment.PaidAt
+	}
+	return nil
+}
+
+func writeInvoice(pdf *fpdf.Fpdf, inv models.Invoice, batch string) {
+	loc := centreLocation()
+
+	number, issued := "Draft", "-"
+	if inv.Number != "" {
+		number = inv.Number
+	}
+	if inv.IssuedAt != nil {
+		issued = inv.IssuedAt.In(loc).Format("02 January 2006")
+	}
+	due := inv.DueDate
+	if d, err := time.Parse(dateLayout, inv.DueDate); err == nil {
+		due = d.Format("02 January 2006")
+	}
+
+	pdfField(pdf, "Invoice No", number)
+	pdfField(pdf, "Date", issued)
+	pdfField(pdf, "Due by", due)
+	pdf.Ln(3)
+	pdfField(pdf, "Bill to", inv.BillTo)
+	pdfField(pdf, "Student", inv.StudentName)
+	pdfField(pdf, "Class", inv.Class)
+	pdfField(pdf, "Subject", inv.Subject)
+	if batch != "" {
+		pdfField(pdf, "Batch", batch)
+	}
+	pdfField(pdf, "Period", receiptPeriod([]string{inv.Month}))
+	pdf.Ln(3)
+
+	rows := [][]string{}
+	for _, l := range inv.Lines {
+		rows = append(rows, []string{l.Description, formatTaka(l.Amount)})
+	}
+	rows = append(rows, []string{"Total", formatTaka(inv.Total)})
+	pdfTable(pdf, []string{"Item", "Amount (Tk)"}, []float64{140, 40}, rows)
+	pdf.Ln(3)
+
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(40, 7, "In words:", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, 7, amountInWords(inv.Total), "", "L", false)
+
+	switch inv.Status {
+	case models.InvoicePaid:
+		paid := ""
+		if inv.PaidAt != nil {
+			paid = " on " + inv.PaidAt.In(loc).Format("02 January 2006")
+		}
+		pdf.Ln(3)
+		pdfField(pdf, "Paid", "Receipt "+inv.ReceiptNo+paid)
+		pdfStamp(pdf, "PAID")
+	case models.InvoiceVoid:
+		pdf.Ln(3)
+		pdfField(pdf, "Void", inv.VoidReason)
+		pdfStamp(pdf, "VOID")
+	case models.InvoiceDraft:
+		pdfStamp(pdf, "DRAFT")
+	}
+}
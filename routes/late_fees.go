@@ -0,0 +1,554 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BalanceLine is one thing a student still owes, or a credit against it
+type BalanceLine struct {
+	Month       string  `json:"month"`
+	Kind        string  `json:"kind"` // fee, late_fee or credit
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	LateFeeID   string  `json:"late_fee_id,omitempty"`
+}
+
+// GetLateFeePolicies lists the late fee policies
+func GetLateFeePolicies(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	policies, err := loadLateFeePolicies(ctx, bson.M{})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch late fee policies"})
+	}
+	return c.JSON(policies)
+}
+
+// AddLateFeePolicy creates a policy, e.g.
+// {"name":"Standard","grace_days":10,"kind":"percent","amount":5,"cap":200}.
+// It replaces the active policy for the same batch (or the general one).
+// Late fees are charged per student, not per enrolment, so a batch policy
+// only applies to students whose own batch (the one on their record) it is.
+func AddLateFeePolicy(c *fiber.Ctx) error {
+	var policy models.LateFeePolicy
+	if err := c.BodyParser(&policy); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	policy.Name = strings.TrimSpace(policy.Name)
+	if policy.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "name is required"})
+	}
+	if policy.GraceDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "grace_days can't be negative"})
+	}
+	if policy.Cap < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "cap can't be negative"})
+	}
+	switch policy.Kind {
+	case models.LateFeeFlat:
+		if policy.Amount <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "amount must be more than 0"})
+		}
+	case models.LateFeePercent:
+		if policy.Amount <= 0 || policy.Amount > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "amount must be between 0 and 100"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be flat or percent"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if policy.BatchID != "" && batchName(ctx, policy.BatchID) == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+
+	policy.ID = primitive.NewObjectID()
+	policy.Active = true
+	policy.CreatedAt = time.Now()
+
+	collection := database.DB.Collection("late_fee_policies")
+	_, err := collection.UpdateMany(ctx,
+		bson.M{"batch_id": policy.BatchID, "active": true},
+		bson.M{"$set": bson.M{"active": false}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to replace old policy"})
+	}
+	if _, err := collection.InsertOne(ctx, policy); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert late fee policy"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(policy)
+}
+
+// DeleteLateFeePolicy stops a policy; fees it already charged stay
+func DeleteLateFeePolicy(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("late_fee_policies").UpdateByID(ctx, objID, bson.M{"$set": bson.M{"active": false}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete late fee policy"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Late fee policy not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Late fee policy deleted successfully"})
+}
+
+// GetLateFees lists charged late fees, optionally for one ?student_id= or
+// ?month=; ?outstanding=true leaves out waived and collected ones
+func GetLateFees(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if studentID := c.Query("student_id"); studentID != "" {
+		filter["student_id"] = studentID
+	}
+	if month := c.Query("month"); month != "" {
+		filter["month"] = month
+	}
+	if c.Query("outstanding") == "true" {
+		filter["waived"] = false
+		filter["payment_id"] = bson.M{"$in": bson.A{nil, ""}}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "month", Value: -1}, {Key: "student_name", Value: 1}})
+	cursor, err := database.DB.Collection("late_fees").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch late fees"})
+	}
+
+	fees := []models.LateFee{}
+	if err := cursor.All(ctx, &fees); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse late fees"})
+	}
+	return c.JSON(fees)
+}
+
+// ApplyLateFees charges late fees for every overdue month now rather than
+// waiting for the hourly run
+func ApplyLateFees(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	applied, err := applyLateFees(ctx, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to apply late fees"})
+	}
+	return c.JSON(fiber.Map{"success": true, "applied": applied})
+}
+
+// WaiveLateFee lets an admin drop a late fee: {"reason": "..."}
+func WaiveLateFee(c *fiber.Ctx) error {
+	if !auth.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only an admin can waive late fees"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "reason is required"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := database.DB.Collection("late_fees").UpdateOne(ctx,
+		bson.M{"_id": objID, "waived": false, "payment_id": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"$set": bson.M{
+			"waived":       true,
+			"waived_by":    auth.CurrentUser(c),
+			"waived_at":    now,
+			"waive_reason": req.Reason,
+		}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to waive late fee"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Late fee not found, already waived or already paid"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Late fee waived"})
+}
+
+// GetStudentBalance lists what a student owes: the fee of every unpaid
+// month and every late fee not yet collected or waived, less unspent
+// credit notes
+func GetStudentBalance(c *fiber.Ctx) error {
+	studentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": studentID}).Decode(&student); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fees"})
+	}
+
+	lines := []BalanceLine{}
+	for _, month := range studentDueMonths(student, time.Now()) {
+		fee := fees.fee(student, month)
+		lines = append(lines, BalanceLine{
+			Month:       month,
+			Kind:        models.LineFee,
+			Description: feeDescription(month, fee),
+			Amount:      fee.Effective,
+		})
+	}
+
+	lateFees, err := outstandingLateFees(ctx, student.ID.Hex(), "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch late fees"})
+	}
+	for _, lf := range lateFees {
+		lines = append(lines, BalanceLine{
+			Month:       lf.Month,
+			Kind:        models.LineLateFee,
+			Description: lateFeeDescription(lf.Month),
+			Amount:      lf.Amount,
+			LateFeeID:   lf.ID.Hex(),
+		})
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Month < lines[j].Month })
+
+	// Unspent credit notes come off what is owed
+	credits, err := studentCredits(ctx, student.ID.Hex())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch credit notes"})
+	}
+	for _, cr := range credits {
+		lines = append(lines, BalanceLine{
+			Kind:        models.LineCredit,
+			Description: "Credit note " + cr.Refund.Number,
+			Amount:      -cr.Remaining,
+		})
+	}
+
+	total := 0.0
+	for _, l := range lines {
+		total += l.Amount
+	}
+	return c.JSON(fiber.Map{"student_id": student.ID.Hex(), "name": student.Name, "lines": lines, "total": round2(total)})
+}
+
+// RunLateFees charges late fees once an hour; main starts it in the
+// background
+func RunLateFees() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		if applied, err := applyLateFees(ctx, time.Now()); err != nil {
+			log.Println("❌ Failed to apply late fees:", err)
+		} else if applied > 0 {
+			log.Printf("✅ Applied %d late fees", applied)
+		}
+		cancel()
+		time.Sleep(time.Hour)
+	}
+}
+
+// applyLateFees charges a late fee for each student month that is past its
+// policy's grace period and hasn't been charged yet. It is safe to run
+// again: each student month is charged at most once.
+//
+// A late fee is one charge per student and month, on the fee of all their
+// enrolments together. The policy is the one for the batch on the
+// student's record, or the general one; policies of their other batches
+// are not used.
+func applyLateFees(ctx context.Context, now time.Time) (int, error) {
+	policies, err := loadLateFeePolicies(ctx, bson.M{"active": true})
+	if err != nil || len(policies) == 0 {
+		return 0, err
+	}
+	byBatch := map[string]models.LateFeePolicy{}
+	for _, p := range policies {
+		byBatch[p.BatchID] = p
+	}
+
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cursor, err := database.DB.Collection("students").Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	var students []models.Student
+	if err := cursor.All(ctx, &students); err != nil {
+		return 0, err
+	}
+
+	collection := database.DB.Collection("late_fees")
+	applied := 0
+	for _, s := range students {
+		policy, ok := byBatch[s.BatchID]
+		if !ok {
+			if policy, ok = byBatch[""]; !ok {
+				continue
+			}
+		}
+
+		for _, month := range studentDueMonths(s, now) {
+			if !lateFeeDue(policy, month, now) {
+				continue
+			}
+
+			amount := lateFeeAmount(policy, fees.fee(s, month).Effective)
+			if amount <= 0 {
+				continue
+			}
+
+			charge := models.LateFee{
+				ID:          primitive.NewObjectID(),
+				StudentID:   s.ID.Hex(),
+				StudentName: s.Name,
+				BatchID:     s.BatchID,
+				Month:       month,
+				PolicyID:    policy.ID.Hex(),
+				Amount:      amount,
+				AppliedAt:   now,
+			}
+			res, err := collection.UpdateOne(ctx,
+				bson.M{"student_id": charge.StudentID, "month": month},
+				bson.M{"$setOnInsert": charge},
+				options.Update().SetUpsert(true),
+			)
+			if mongo.IsDuplicateKeyError(err) {
+				continue // charged by a run at the same moment
+			}
+			if err != nil {
+				return applied, err
+			}
+			if res.UpsertedCount > 0 {
+				applied++
+			}
+		}
+	}
+	return applied, nil
+}
+
+// lateFeeDue reports whether a policy charges a late fee on a month by
+// now: its grace period is over, and ended after the policy was made, so a
+// new policy doesn't reach back over months that were overdue before it
+func lateFeeDue(p models.LateFeePolicy, month string, now time.Time) bool {
+	start, _, err := monthBounds(month)
+	if err != nil {
+		return false
+	}
+	deadline := start.AddDate(0, 0, p.GraceDays)
+	return now.After(deadline) && deadline.After(p.CreatedAt)
+}
+
+// lateFeeAmount is what a policy charges on a month's fee
+func lateFeeAmount(p models.LateFeePolicy, fee float64) float64 {
+	amount := p.Amount
+	if p.Kind == models.LateFeePercent {
+		amount = fee * p.Amount / 100
+	}
+	if p.Cap > 0 && amount > p.Cap {
+		amount = p.Cap
+	}
+	return round2(amount)
+}
+
+// studentDueMonths lists a student's unpaid months (YYYY-MM): the
+// due_months written by the monthly export, plus this month while unpaid
+func studentDueMonths(s models.Student, now time.Time) []string {
+	seen := map[string]bool{}
+	var months []string
+	add := func(m string) {
+		if !seen[m] {
+			seen[m] = true
+			months = append(months, m)
+		}
+	}
+
+	for _, label := range s.DueMonths {
+		if month, err := time.Parse(dueMonthLayout, label); err == nil {
+			add(month.Format(monthLayout))
+		}
+	}
+	if !s.PaymentStatus {
+		add(now.Format(monthLayout))
+	}
+
+	sort.Strings(months)
+	return months
+}
+
+// monthPaymentLines is what a student pays for a month: the fee after
+// discounts of each enrolment not paid yet and any late fee charged for
+// the month, less whatever credit notes can cover
+func monthPaymentLines(ctx context.Context, s models.Student, month string) ([]models.PaymentLine, error) {
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fee := fees.fee(s, month)
+	parts := fee.Parts
+	if parts == nil {
+		parts = []*models.Fee{fee}
+	}
+
+	paid, err := paidEnrolments(ctx, month, s.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	lines := []models.PaymentLine{}
+	for _, part := range parts {
+		if part.EnrolmentID != "" && paid[part.EnrolmentID] {
+			continue
+		}
+		lines = append(lines, feeLine(month, part))
+	}
+
+	lateFees, err := outstandingLateFees(ctx, s.ID.Hex(), month)
+	if err != nil {
+		return nil, err
+	}
+	for _, lf := range lateFees {
+		lines = append(lines, models.PaymentLine{
+			Kind:        models.LineLateFee,
+			Description: lateFeeDescription(month),
+			Amount:      lf.Amount,
+			LateFeeID:   lf.ID.Hex(),
+		})
+	}
+
+	return applyCredits(ctx, s.ID.Hex(), lines)
+}
+
+// feeLine charges one enrolment's fee for a month
+func feeLine(month string, fee *models.Fee) models.PaymentLine {
+	return models.PaymentLine{
+		Kind:        models.LineFee,
+		Description: feeDescription(month, fee),
+		Amount:      fee.Effective,
+		EnrolmentID: fee.EnrolmentID,
+		BatchID:     fee.BatchID,
+	}
+}
+
+// applyCredits adds credit lines for the student's credit notes, oldest
+// first, until they cover the lines or run out
+func applyCredits(ctx context.Context, studentID string, lines []models.PaymentLine) ([]models.PaymentLine, error) {
+	total := 0.0
+	for _, l := range lines {
+		total += l.Amount
+	}
+	credits, err := studentCredits(ctx, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cr := range credits {
+		if total <= 0 {
+			break
+		}
+		amount := math.Min(cr.Remaining, total)
+		total -= amount
+		lines = append(lines, models.PaymentLine{
+			Kind:        models.LineCredit,
+			Description: "Credit note " + cr.Refund.Number,
+			Amount:      -round2(amount),
+			RefundID:    cr.Refund.ID.Hex(),
+		})
+	}
+	return lines, nil
+}
+
+// outstandingLateFees are a student's late fees neither collected nor
+// waived, for one month or all when month is empty
+func outstandingLateFees(ctx context.Context, studentID, month string) ([]models.LateFee, error) {
+	filter := bson.M{
+		"student_id": studentID,
+		"waived":     false,
+		"payment_id": bson.M{"$in": bson.A{nil, ""}},
+	}
+	if month != "" {
+		filter["month"] = month
+	}
+
+	cursor, err := database.DB.Collection("late_fees").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	fees := []models.LateFee{}
+	if err := cursor.All(ctx, &fees); err != nil {
+		return nil, err
+	}
+	return fees, nil
+}
+
+func feeDescription(month string, fee *models.Fee) string {
+	start, _, _ := monthBounds(month)
+	description := "Fee for " + start.Format("January 2006")
+	if fee.Subject != "" {
+		description = fee.Subject + " fee for " + start.Format("January 2006")
+	}
+	if reason := discountReason(fee); reason != "" {
+		description += ", less " + reason
+	}
+	return description
+}
+
+func lateFeeDescription(month string) string {
+	start, _, _ := monthBounds(month)
+	return "Late fee for " + start.Format("January 2006")
+}
+
+func loadLateFeePolicies(ctx context.Context, filter bson.M) ([]models.LateFeePolicy, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := database.DB.Collection("late_fee_policies").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	policies := []models.LateFeePolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
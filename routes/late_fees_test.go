@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dishan1223/cms/models"
+)
+
+func TestLateFeeAmount(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy models.LateFeePolicy
+		fee    float64
+		want   float64
+	}{
+		{"flat", models.LateFeePolicy{Kind: models.LateFeeFlat, Amount: 50}, 1500, 50},
+		{"flat over cap", models.LateFeePolicy{Kind: models.LateFeeFlat, Amount: 250, Cap: 200}, 1500, 200},
+		{"percent", models.LateFeePolicy{Kind: models.LateFeePercent, Amount: 5}, 1500, 75},
+		{"percent over cap", models.LateFeePolicy{Kind: models.LateFeePercent, Amount: 10, Cap: 200}, 3000, 200},
+		{"percent under cap", models.LateFeePolicy{Kind: models.LateFeePercent, Amount: 10, Cap: 200}, 1500, 150},
+		{"percent rounds to paisa", models.LateFeePolicy{Kind: models.LateFeePercent, Amount: 3}, 333.33, 10},
+		{"percent of a free month", models.LateFeePolicy{Kind: models.LateFeePercent, Amount: 5}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lateFeeAmount(tt.policy, tt.fee); got != tt.want {
+				t.Errorf("lateFeeAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStudentDueMonths(t *testing.T) {
+	now := time.Date(2025, time.March, 15, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		student models.Student
+		want    []string
+	}{
+		{"paid up", models.Student{PaymentStatus: true}, nil},
+		{"this month unpaid", models.Student{}, []string{"2025-03"}},
+		{
+			"earlier months in order",
+			models.Student{PaymentStatus: true, DueMonths: []string{"February_2025", "January_2025"}},
+			[]string{"2025-01", "2025-02"},
+		},
+		{
+			"this month listed once",
+			models.Student{DueMonths: []string{"March_2025", "January_2025"}},
+			[]string{"2025-01", "2025-03"},
+		},
+		{
+			"unreadable entries skipped",
+			models.Student{PaymentStatus: true, DueMonths: []string{"January", "December_2024"}},
+			[]string{"2024-12"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := studentDueMonths(tt.student, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("studentDueMonths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLateFeeDue(t *testing.T) {
+	policy := models.LateFeePolicy{
+		GraceDays: 10,
+		CreatedAt: time.Date(2025, time.March, 5, 0, 0, 0, 0, time.Local),
+	}
+	tests := []struct {
+		name  string
+		month string
+		now   time.Time
+		want  bool
+	}{
+		{"in grace", "2025-04", time.Date(2025, time.April, 10, 12, 0, 0, 0, time.Local), false},
+		{"past grace", "2025-04", time.Date(2025, time.April, 11, 12, 0, 0, 0, time.Local), true},
+		{"grace ended after the policy", "2025-03", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.Local), true},
+		{"overdue before the policy", "2025-02", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.Local), false},
+		{"bad month", "2025-4", time.Date(2025, time.April, 30, 0, 0, 0, 0, time.Local), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lateFeeDue(policy, tt.month, tt.now); got != tt.want {
+				t.Errorf("lateFeeDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Header names recognised without an explicit mapping
+var marksHeaderAliases = map[string][]string{
+	"student_id":   {"Student ID", "ID"},
+	"phone_number": {"Phone", "Phone Number", "Mobile"},
+	"name":         {"Name", "Student", "Student Name"},
+	"cq":           {"CQ", "CQ Marks", "Written"},
+	"mcq":          {"MCQ", "MCQ Marks"},
+	"remarks":      {"Remarks", "Comment"},
+}
+
+// MarksImportRow is the preview of one spreadsheet row
+type MarksImportRow struct {
+	Row       int      `json:"row"`
+	StudentID string   `json:"student_id"`
+	Name      string   `json:"name"`
+	Phone     string   `json:"phone_number"`
+	CQ        string   `json:"cq"`
+	MCQ       string   `json:"mcq"`
+	Total     int      `json:"total"`
+	Remarks   string   `json:"remarks"`
+	Matched   bool     `json:"matched"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ImportMarks reads exam marks from an uploaded .xlsx/.csv file.
+//
+// Form fields: file, optional mapping (JSON object of header -> field, where
+// field is one of student_id, phone_number, name, cq, mcq, remarks) and
+// commit=true to save. The exam itself is described with the same query
+// params as SubmitResults (?exam=&date=&full_marks=&batch_id=...).
+// Without commit the response is only a preview.
+func ImportMarks(c *fiber.Ctx) error {
+	name := c.Query("exam")
+	if name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "exam name is required"})
+	}
+	exam, err := examFromQuery(c, name)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	mapping := map[string]string{}
+	if m := c.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "mapping must be a JSON object"})
+		}
+		for h, field := range mapping {
+			if _, ok := marksHeaderAliases[field]; !ok {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown field %q for column %q", field, h)})
+			}
+		}
+	}
+
+	sheets, err := readUploadedSheets(c, "file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(sheets) == 0 || len(sheets[0].Rows) < 2 {
+		return c.Status(400).JSON(fiber.Map{"error": "file has no data rows"})
+	}
+
+	rows := sheets[0].Rows
+	index := headerIndex(rows[0], mapping, marksHeaderAliases)
+	if _, ok := index["cq"]; !ok {
+		if _, ok := index["mcq"]; !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "no CQ or MCQ column found", "header": rows[0]})
+		}
+	}
+	_, hasID := index["student_id"]
+	_, hasPhone := index["phone_number"]
+	if !hasID && !hasPhone {
+		return c.Status(400).JSON(fiber.Map{"error": "a student ID or phone number column is required", "header": rows[0]})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := checkSubmitter(ctx, exam); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	matcher, err := newStudentMatcher(ctx, exam.BatchID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+
+	preview := []MarksImportRow{}
+	unmatched := []MarksImportRow{}
+	invalid := 0
+	seen := map[string]int{}
+
+	for i, row := range rows[1:] {
+		if blankRow(row) {
+			continue
+		}
+
+		r := MarksImportRow{
+			Row:       i + 2,
+			StudentID: cell(row, index, "student_id"),
+			Name:      cell(row, index, "name"),
+			Phone:     cell(row, index, "phone_number"),
+			CQ:        normalizeMarks(cell(row, index, "cq")),
+			MCQ:       normalizeMarks(cell(row, index, "mcq")),
+			Remarks:   cell(row, index, "remarks"),
+		}
+
+		for _, v := range []struct{ label, val string }{{"CQ", r.CQ}, {"MCQ", r.MCQ}} {
+			if v.val == "" || v.val == "Absent" {
+				continue
+			}
+			if n, err := strconv.Atoi(v.val); err != nil || n < 0 {
+				r.Errors = append(r.Errors, fmt.Sprintf("%s must be a whole number or Absent", v.label))
+			}
+		}
+		r.Total = parseMarks(r.CQ) + parseMarks(r.MCQ)
+		if float64(r.Total) > exam.FullMarks {
+			r.Errors = append(r.Errors, fmt.Sprintf("total %d is more than full marks %g", r.Total, exam.FullMarks))
+		}
+
+		if student, reason := matcher.match(r.StudentID, r.Phone, r.Name); student != nil {
+			r.Matched = true
+			r.StudentID = student.ID.Hex()
+			if r.Name == "" {
+				r.Name = student.Name
+			}
+			if r.Phone == "" {
+				r.Phone = student.PhoneNumber
+			}
+			if prev, dup := seen[r.StudentID]; dup {
+				r.Errors = append(r.Errors, fmt.Sprintf("same student as row %d", prev))
+			}
+			seen[r.StudentID] = r.Row
+		} else {
+			r.Errors = append(r.Errors, reason)
+			unmatched = append(unmatched, r)
+		}
+
+		if len(r.Errors) > 0 && r.Matched {
+			invalid++
+		}
+		preview = append(preview, r)
+	}
+
+	response := fiber.Map{
+		"exam":      exam,
+		"rows":      preview,
+		"matched":   len(preview) - len(unmatched),
+		"unmatched": unmatched,
+		"invalid":   invalid,
+		"committed": false,
+	}
+
+	if c.FormValue("commit") != "true" {
+		return c.JSON(response)
+	}
+
+	if invalid > 0 || len(unmatched) > 0 {
+		response["error"] = "Fix the unmatched and invalid rows before committing"
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	results := make([]StudentResult, 0, len(preview))
+	for _, r := range preview {
+		results = append(results, StudentResult{
+			StudentID:   r.StudentID,
+			Name:        r.Name,
+			PhoneNumber: r.Phone,
+			CQ:          r.CQ,
+			MCQ:         r.MCQ,
+			Remarks:     r.Remarks,
+		})
+	}
+
+	if _, err := saveExamResults(ctx, exam, results); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save results"})
+	}
+
+	response["committed"] = true
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// Spreadsheets say absent in all sorts of ways
+func normalizeMarks(v string) string {
+	switch strings.ToLower(v) {
+	case "absent", "abs", "a", "ab":
+		return "Absent"
+	}
+	return v
+}
+
+// studentMatcher finds students by ID or phone number
+type studentMatcher struct {
+	byID    map[string]*models.Student
+	byPhone map[string][]*models.Student
+}
+
+// newStudentMatcher loads all students, or just those enrolled in one batch
+// when batchID is set
+func newStudentMatcher(ctx context.Context, batchID string) (*studentMatcher, error) {
+	var students []models.Student
+	var err error
+	if batchID != "" {
+		students, err = enrolledStudents(ctx, batchID, time.Now().Format(dateLayout))
+	} else {
+		err = findAll(ctx, "students", bson.M{}, &students)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &studentMatcher{byID: map[string]*models.Student{}, byPhone: map[string][]*models.Student{}}
+	for i := range students {
+		s := &students[i]
+		m.byID[s.ID.Hex()] = s
+		phone := normalizePhone(s.PhoneNumber)
+		m.byPhone[phone] = append(m.byPhone[phone], s)
+	}
+	return m, nil
+}
+
+// match returns the student or the reason no single student was found.
+// Siblings sharing a phone number are told apart by name.
+func (m *studentMatcher) match(id, phone, name string) (*models.Student, string) {
+	if id != "" {
+		if _, err := primitive.ObjectIDFromHex(id); err != nil {
+			return nil, "invalid student ID"
+		}
+		if s, ok := m.byID[id]; ok {
+			return s, ""
+		}
+		return nil, "no student with this ID"
+	}
+
+	if phone == "" {
+		return nil, "no student ID or phone number"
+	}
+
+	candidates := m.byPhone[normalizePhone(phone)]
+	switch len(candidates) {
+	case 0:
+		return nil, "no student with this phone number"
+	case 1:
+		return candidates[0], ""
+	}
+
+	for _, s := range candidates {
+		if name != "" && strings.EqualFold(strings.TrimSpace(s.Name), name) {
+			return s, ""
+		}
+	}
+	return nil, "several students share this phone number"
+}
+
+// normalizePhone reduces a number to its last 11 digits so that
+// +8801XXXXXXXXX, 8801XXXXXXXXX and 01XXXXXXXXX compare equal
+func normalizePhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	if len(digits) > 11 {
+		digits = digits[len(digits)-11:]
+	}
+	return digits
+}
@@ -0,0 +1,22 @@
+package routes
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"01712345678", "01712345678"},
+		{"+8801712345678", "01712345678"},
+		{"8801712345678", "01712345678"},
+		{"+880 1712-345678", "01712345678"},
+		{"01712 345 678", "01712345678"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePhone(tt.phone); got != tt.want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
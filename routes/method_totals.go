@@ -0,0 +1,92 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetCollectionsByMethod totals the payments taken on ?date= (YYYY-MM-DD,
+// default today) by method and by who collected them, so the cash drawer
+// and the wallet statements can be checked against the ledger at day end
+func GetCollectionsByMethod(c *fiber.Ctx) error {
+	date := c.Query("date", time.Now().In(centreLocation()).Format(dateLayout))
+	start, err := time.ParseInLocation(dateLayout, date, centreLocation())
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	totals, err := methodTotals(ctx, start, start.AddDate(0, 0, 1))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to sum payments"})
+	}
+
+	count, amount := 0, 0.0
+	for _, t := range totals {
+		count += t.Count
+		amount += t.Amount
+	}
+
+	return c.JSON(fiber.Map{
+		"date":    date,
+		"methods": totals,
+		"count":   count,
+		"total":   round2(amount),
+	})
+}
+
+// methodTotals groups the payments that aren't void from start up to end
+// by method and collector. Payments without a method were taken as cash.
+func methodTotals(ctx context.Context, start, end time.Time) ([]models.MethodTotal, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"void": false, "paid_at": bson.M{"$gte": start, "$lt": end}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"method":       bson.M{"$ifNull": bson.A{"$method", models.MethodCash}},
+				"collected_by": "$collected_by",
+			},
+			"count":  bson.M{"$sum": 1},
+			"amount": bson.M{"$sum": "$amount"},
+		}},
+		{"$sort": bson.M{"_id.method": 1, "_id.collected_by": 1}},
+	}
+
+	cursor, err := database.DB.Collection("payments").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Key struct {
+			Method      string `bson:"method"`
+			CollectedBy string `bson:"collected_by"`
+		} `bson:"_id"`
+		Count  int     `bson:"count"`
+		Amount float64 `bson:"amount"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	totals := []models.MethodTotal{}
+	for _, r := range rows {
+		method := r.Key.Method
+		if method == "" {
+			method = models.MethodCash
+		}
+		if len(totals) == 0 || totals[len(totals)-1].Method != method {
+			totals = append(totals, models.MethodTotal{Method: method, Name: methodName(method), Collectors: []models.CollectorTotal{}})
+		}
+		t := &totals[len(totals)-1]
+		t.Count += r.Count
+		t.Amount = round2(t.Amount + r.Amount)
+		t.Collectors = append(t.Collectors, models.CollectorTotal{CollectedBy: r.Key.CollectedBy, Count: r.Count, Amount: round2(r.Amount)})
+	}
+	return totals, nil
+}
@@ -0,0 +1,53 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+var smsClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendSMS is the one place notifications go out. The message is always
+// logged; when SMS_API_URL is set it is also posted to that gateway as a
+// form with to, message and api_key (SMS_API_KEY). The post happens in the
+// background so a slow gateway doesn't hold up the request that sent it.
+func sendSMS(phone, message string) {
+	log.Println("\n📢 SMS to " + phone + ":\n" + message)
+
+	gateway := os.Getenv("SMS_API_URL")
+	if gateway == "" || phone == "" {
+		return
+	}
+
+	form := url.Values{
+		"to":      {phone},
+		"message": {message},
+		"api_key": {os.Getenv("SMS_API_KEY")},
+	}
+	go postSMS(gateway, form)
+}
+
+func postSMS(gateway string, form url.Values) {
+	resp, err := smsClient.PostForm(gateway, form)
+	if err != nil {
+		log.Println("❌ Failed to send SMS:", err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Println("❌ SMS gateway returned", resp.Status)
+	}
+}
+
+// fillTemplate replaces {key} placeholders in a message template
+func fillTemplate(template string, values map[string]string) string {
+	for k, v := range values {
+		template = strings.ReplaceAll(template, "{"+k+"}", v)
+	}
+	return template
+}
@@ -0,0 +1,290 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const monthLayout = "2006-01"
+
+var errDuplicateTransaction = errors.New("transaction ID already used")
+
+var errAlreadyPaid = errors.New("already paid")
+
+// PaymentMethod is how a payment was made, as sent by the counter
+type PaymentMethod struct {
+	Method        string `json:"method"`
+	TransactionID string `json:"transaction_id"`
+	SenderNumber  string `json:"sender_number"`
+}
+
+// normalize checks the fields each method needs and tidies them. Cash is
+// assumed when no method is given.
+func (m *PaymentMethod) normalize() error {
+	m.Method = strings.ToLower(strings.TrimSpace(m.Method))
+	m.TransactionID = strings.ToUpper(strings.TrimSpace(m.TransactionID))
+	m.SenderNumber = strings.TrimSpace(m.SenderNumber)
+
+	switch m.Method {
+	case "", models.MethodCash:
+		m.Method = models.MethodCash
+		m.TransactionID, m.SenderNumber = "", ""
+	case models.MethodBkash, models.MethodNagad:
+		if m.TransactionID == "" {
+			return fmt.Errorf("transaction_id is required for %s", m.Method)
+		}
+		if len(normalizePhone(m.SenderNumber)) != 11 {
+			return fmt.Errorf("sender_number must be an 11 digit %s number", m.Method)
+		}
+		m.SenderNumber = normalizePhone(m.SenderNumber)
+	case models.MethodBank:
+		if m.TransactionID == "" {
+			return fmt.Errorf("transaction_id (the bank reference) is required")
+		}
+	default:
+		return fmt.Errorf("method must be cash, bkash, nagad or bank")
+	}
+	return nil
+}
+
+// newPayment is a payment of the given lines, paid now
+func newPayment(student models.Student, months []string, lines []models.PaymentLine, method PaymentMethod, collector string) *models.Payment {
+	amount := 0.0
+	for _, l := range lines {
+		amount += l.Amount
+	}
+
+	return &models.Payment{
+		ID:            primitive.NewObjectID(),
+		StudentID:     student.ID.Hex(),
+		StudentName:   student.Name,
+		BatchID:       student.BatchID,
+		Class:         student.Class,
+		Subject:       student.Subject,
+		Months:        months,
+		Amount:        round2(amount),
+		Lines:         lines,
+		Method:        method.Method,
+		TransactionID: method.TransactionID,
+		SenderNumber:  method.SenderNumber,
+		PaidAt:        time.Now(),
+		CollectedBy:   collector,
+	}
+}
+
+// savePayment adds a payment to the ledger and gives it the next receipt
+// number. Late fees among the lines are marked collected, and so are issued
+// invoices for the months. Run it in a transaction so a failed insert
+// doesn't leave a gap in the numbering. A transaction ID already on a
+// payment that isn't void fails with errDuplicateTransaction.
+func savePayment(sc context.Context, payment *models.Payment) error {
+	if payment.TransactionID != "" {
+		used, err := database.DB.Collection("payments").CountDocuments(sc, bson.M{
+			"method":         payment.Method,
+			"transaction_id": payment.TransactionID,
+			"void":           false,
+		})
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			return errDuplicateTransaction
+		}
+	}
+
+	year := financialYear(payment.PaidAt)
+	seq, err := nextSequence(sc, "receipt:"+year)
+	if err != nil {
+		return err
+	}
+	payment.ReceiptNo = fmt.Sprintf("%s-%05d", year, seq)
+
+	if _, err := database.DB.Collection("payments").InsertOne(sc, payment); err != nil {
+		return err
+	}
+
+	for _, l := range payment.Lines {
+		if l.LateFeeID == "" {
+			continue
+		}
+		lateFeeID, err := primitive.ObjectIDFromHex(l.LateFeeID)
+		if err != nil {
+			return err
+		}
+		_, err = database.DB.Collection("late_fees").UpdateByID(sc, lateFeeID,
+			bson.M{"$set": bson.M{"payment_id": payment.ID.Hex()}})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Issued invoices for these months are now paid
+	_, err = database.DB.Collection("invoices").UpdateMany(sc,
+		bson.M{"student_id": payment.StudentID, "month": bson.M{"$in": payment.Months}, "status": models.InvoiceIssued},
+		bson.M{"$set": bson.M{
+			"status":     models.InvoicePaid,
+			"payment_id": payment.ID.Hex(),
+			"receipt_no": payment.ReceiptNo,
+			"paid_at":    payment.PaidAt,
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	return refreshDayClose(sc, payment.PaidAt)
+}
+
+// monthPayment is the latest payment that isn't void covering a student's
+// month (YYYY-MM), nil if there is none
+func monthPayment(ctx context.Context, studentID, month string) (*models.Payment, error) {
+	opts := options.FindOne().SetSort(bson.M{"paid_at": -1})
+
+	var payment models.Payment
+	err := database.DB.Collection("payments").FindOne(ctx,
+		bson.M{"student_id": studentID, "months": month, "void": false},
+		opts,
+	).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// monthPayments lists the payments that aren't void covering a student's
+// month. With enrolments paid one at a time there can be several.
+func monthPayments(ctx context.Context, studentID, month string) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := findAll(ctx, "payments", bson.M{"student_id": studentID, "months": month, "void": false}, &payments)
+	return payments, err
+}
+
+// voidMonthPayments voids every payment covering a student's month, used
+// when the month is toggled back to unpaid. Late fees they collected and
+// invoices they paid are outstanding again.
+func voidMonthPayments(ctx context.Context, payments []models.Payment) error {
+	if len(payments) == 0 {
+		return nil
+	}
+	ids := []primitive.ObjectID{}
+	hexIDs := []string{}
+	for _, p := range payments {
+		ids = append(ids, p.ID)
+		hexIDs = append(hexIDs, p.ID.Hex())
+	}
+
+	_, err := database.DB.Collection("payments").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "void": false},
+		bson.M{"$set": bson.M{"void": true, "voided_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.DB.Collection("late_fees").UpdateMany(ctx,
+		bson.M{"payment_id": bson.M{"$in": hexIDs}},
+		bson.M{"$unset": bson.M{"payment_id": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Invoices they paid are owed again
+	_, err = database.DB.Collection("invoices").UpdateMany(ctx,
+		bson.M{"payment_id": bson.M{"$in": hexIDs}, "status": models.InvoicePaid},
+		bson.M{
+			"$set":   bson.M{"status": models.InvoiceIssued},
+			"$unset": bson.M{"payment_id": "", "receipt_no": "", "paid_at": ""},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range payments {
+		if err := refreshDayClose(ctx, p.PaidAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// monthBounds returns the first instant of a YYYY-MM month and of the next
+func monthBounds(month string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation(monthLayout, month, centreLocation())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// nextSequence increments and returns the named counter
+func nextSequence(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := database.DB.Collection("counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		opts,
+	).Decode(&counter)
+	return counter.Seq, err
+}
+
+// financialYear names the July-June year a moment falls in, e.g. 2025-26
+func financialYear(t time.Time) string {
+	t = t.In(centreLocation())
+	start := t.Year()
+	if t.Month() < time.July {
+		start--
+	}
+	return fmt.Sprintf("%d-%02d", start, (start+1)%100)
+}
+
+// markMonthPaid moves a month (YYYY-MM) from a student's due months to the
+// paid ones, the way TogglePaymentStatus does for the current month
+func markMonthPaid(ctx context.Context, student models.Student, month string) error {
+	start, _, err := monthBounds(month)
+	if err != nil {
+		return err
+	}
+	name := start.Format("January")
+
+	paid := student.PaidMonths
+	found := false
+	for _, m := range paid {
+		if m == name {
+			found = true
+		}
+	}
+	if !found {
+		paid = append(paid, name)
+	}
+
+	due := []string{}
+	for _, m := range student.DueMonths {
+		if m != name && m != start.Format(dueMonthLayout) {
+			due = append(due, m)
+		}
+	}
+
+	set := bson.M{"paid_months": paid, "due_months": due}
+	if month == time.Now().Format(monthLayout) {
+		set["payment_status"] = true
+	}
+	_, err = database.DB.Collection("students").UpdateOne(ctx, bson.M{"_id": student.ID}, bson.M{"$set": set})
+	return err
+}
@@ -0,0 +1,457 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetPayRules lists a staff member's pay rules
+func GetPayRules(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rules, err := loadPayRules(ctx, bson.M{"staff_id": c.Params("id")})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch pay rules"})
+	}
+	return c.JSON(rules)
+}
+
+// AddPayRule adds a pay rule to a staff member, e.g.
+// {"type":"fee_share","percent":40,"batch_id":"..."}
+func AddPayRule(c *fiber.Ctx) error {
+	var rule models.PayRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	switch rule.Type {
+	case models.PayFixed, models.PayPerClass:
+		if rule.Amount <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "amount must be more than 0"})
+		}
+	case models.PayFeeShare:
+		if rule.Percent <= 0 || rule.Percent > 100 {
+			return c.Status(400).JSON(fiber.Map{"error": "percent must be between 0 and 100"})
+		}
+	default:
+		return c.Status(400).JSON(fiber.Map{"error": "type must be fixed, per_class or fee_share"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := findStaff(ctx, c.Params("id")); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Staff not found"})
+	}
+	if rule.BatchID != "" && batchName(ctx, rule.BatchID) == "" {
+		return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+
+	rule.ID = primitive.NewObjectID()
+	rule.StaffID = c.Params("id")
+	rule.Active = true
+	rule.CreatedAt = time.Now()
+
+	if _, err := database.DB.Collection("pay_rules").InsertOne(ctx, rule); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert pay rule"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// DeletePayRule stops a pay rule; payslips already made keep their lines
+func DeletePayRule(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := database.DB.Collection("pay_rules").UpdateByID(ctx, objID, bson.M{"$set": bson.M{"active": false}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete pay rule"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Pay rule not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Pay rule deleted successfully"})
+}
+
+// RunPayroll works out every staff member's pay for ?month=YYYY-MM (default
+// last month) from their rules, attendance and payments. Running it again
+// recalculates payslips that haven't been paid out yet.
+func RunPayroll(c *fiber.Ctx) error {
+	month := c.Query("month", time.Now().AddDate(0, -1, 0).Format(monthLayout))
+	if _, _, err := monthBounds(month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rules, err := loadPayRules(ctx, bson.M{"active": true})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch pay rules"})
+	}
+
+	byStaff := make(map[string][]models.PayRule)
+	for _, r := range rules {
+		byStaff[r.StaffID] = append(byStaff[r.StaffID], r)
+	}
+
+	collection := database.DB.Collection("payslips")
+	payslips := []models.Payslip{}
+	skipped := []string{}
+
+	for staffID, staffRules := range byStaff {
+		staff, err := findStaff(ctx, staffID)
+		if err != nil || staff.Status != models.StaffActive {
+			continue
+		}
+
+		var existing models.Payslip
+		err = collection.FindOne(ctx, bson.M{"staff_id": staffID, "month": month}).Decode(&existing)
+		if err == nil && existing.Paid {
+			skipped = append(skipped, staff.Name)
+			continue
+		}
+
+		slip, err := calculatePayslip(ctx, *staff, staffRules, month)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to calculate pay for " + staff.Name})
+		}
+		if !existing.ID.IsZero() {
+			slip.ID = existing.ID
+		}
+
+		opts := options.Replace().SetUpsert(true)
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": slip.ID}, slip, opts); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to save payslip"})
+		}
+		payslips = append(payslips, slip)
+	}
+
+	return c.JSON(fiber.Map{"month": month, "payslips": payslips, "already_paid": skipped})
+}
+
+// GetPayslips lists the payslips of ?month=YYYY-MM
+func GetPayslips(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	payslips, err := loadPayslips(ctx, c.Query("month"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payslips"})
+	}
+	return c.JSON(payslips)
+}
+
+// PayPayslip records that a payslip was paid out: {"method":"cash","note":"..."}
+func PayPayslip(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Method string `json:"method"`
+		Note   string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	res, err := database.DB.Collection("payslips").UpdateOne(ctx,
+		bson.M{"_id": objID, "paid": false},
+		bson.M{"$set": bson.M{
+			"paid":       true,
+			"paid_at":    now,
+			"paid_by":    auth.CurrentUser(c),
+			"pay_method": req.Method,
+			"pay_note":   req.Note,
+		}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record payout"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Payslip not found or already paid"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Payout recorded"})
+}
+
+// ExportPayslips streams the payslips of ?month= as an Excel file
+func ExportPayslips(c *fiber.Ctx) error {
+	month := c.Query("month")
+	if _, _, err := monthBounds(month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	payslips, err := loadPayslips(ctx, month)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payslips"})
+	}
+
+	f := excelize.NewFile()
+	sheet := "Payroll"
+	f.SetSheetName(f.GetSheetName(0), sheet)
+
+	headers := []string{"Staff", "Item", "Quantity", "Rate", "Amount", "Status"}
+	for i, h := range headers {
+		col := string(rune('A' + i))
+		f.SetCellValue(sheet, col+"1", h)
+	}
+
+	row := 2
+	grandTotal := 0.0
+	for _, p := range payslips {
+		status := "UNPAID"
+		if p.Paid {
+			status = "PAID"
+		}
+		for _, l := range p.Lines {
+			f.SetCellValue(sheet, fmt.Sprintf("A%d", row), p.StaffName)
+			f.SetCellValue(sheet, fmt.Sprintf("B%d", row), l.Description)
+			f.SetCellValue(sheet, fmt.Sprintf("C%d", row), l.Quantity)
+			f.SetCellValue(sheet, fmt.Sprintf("D%d", row), l.Rate)
+			f.SetCellValue(sheet, fmt.Sprintf("E%d", row), l.Amount)
+			f.SetCellValue(sheet, fmt.Sprintf("F%d", row), status)
+			row++
+		}
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), p.StaffName)
+		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), "Total")
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), p.Total)
+		f.SetCellValue(sheet, fmt.Sprintf("F%d", row), status)
+		row += 2
+		grandTotal += p.Total
+	}
+	f.SetCellValue(sheet, fmt.Sprintf("B%d", row), "Grand Total")
+	f.SetCellValue(sheet, fmt.Sprintf("E%d", row), grandTotal)
+
+	c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"payroll_%s.xlsx\"", month))
+	buf, _ := f.WriteToBuffer()
+	return c.SendStream(buf)
+}
+
+// PayslipPDF downloads one payslip
+func PayslipPDF(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var p models.Payslip
+	if err := database.DB.Collection("payslips").FindOne(ctx, bson.M{"_id": objID}).Decode(&p); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payslip not found"})
+	}
+
+	monthStart, _, _ := monthBounds(p.Month)
+	pdf := newPDF("Payslip")
+	pdfField(pdf, "Name", p.StaffName)
+	pdfField(pdf, "Month", monthStart.Format("January 2006"))
+	pdf.Ln(4)
+
+	rows := [][]string{}
+	for _, l := range p.Lines {
+		rows = append(rows, []string{l.Description, fmt.Sprintf("%g", l.Quantity), fmt.Sprintf("%.2f", l.Rate), fmt.Sprintf("%.2f", l.Amount)})
+	}
+	rows = append(rows, []string{"Total", "", "", fmt.Sprintf("%.2f", p.Total)})
+	pdfTable(pdf, []string{"Item", "Quantity", "Rate", "Amount"}, []float64{90, 25, 30, 35}, rows)
+	pdf.Ln(6)
+
+	if p.Paid && p.PaidAt != nil {
+		pdfField(pdf, "Paid on", p.PaidAt.Format("02 January 2006"))
+		if p.PayMethod != "" {
+			pdfField(pdf, "Method", p.PayMethod)
+		}
+	} else {
+		pdfField(pdf, "Status", "Not paid yet")
+	}
+
+	return sendPDF(c, pdf, fmt.Sprintf("payslip_%s_%s.pdf", safeFilename(p.StaffName), p.Month))
+}
+
+// calculatePayslip applies a staff member's rules to a month
+func calculatePayslip(ctx context.Context, staff models.Staff, rules []models.PayRule, month string) (models.Payslip, error) {
+	slip := models.Payslip{
+		ID:        primitive.NewObjectID(),
+		StaffID:   staff.ID.Hex(),
+		StaffName: staff.Name,
+		Month:     month,
+		Lines:     []models.PayslipLine{},
+		CreatedAt: time.Now(),
+	}
+
+	for _, rule := range rules {
+		batches, err := ruleBatches(ctx, staff.ID.Hex(), rule)
+		if err != nil {
+			return slip, err
+		}
+
+		switch rule.Type {
+		case models.PayFixed:
+			slip.Lines = append(slip.Lines, models.PayslipLine{
+				RuleID: rule.ID.Hex(), Description: "Fixed monthly pay", Quantity: 1, Rate: rule.Amount, Amount: rule.Amount,
+			})
+
+		case models.PayPerClass:
+			for _, b := range batches {
+				held, err := classesHeld(ctx, b.ID.Hex(), month)
+				if err != nil {
+					return slip, err
+				}
+				slip.Lines = append(slip.Lines, models.PayslipLine{
+					RuleID:      rule.ID.Hex(),
+					Description: "Classes held - " + b.BatchName,
+					Quantity:    float64(held),
+					Rate:        rule.Amount,
+					Amount:      round2(float64(held) * rule.Amount),
+				})
+			}
+
+		case models.PayFeeShare:
+			for _, b := range batches {
+				collected, err := feesCollected(ctx, b.ID.Hex(), month)
+				if err != nil {
+					return slip, err
+				}
+				slip.Lines = append(slip.Lines, models.PayslipLine{
+					RuleID:      rule.ID.Hex(),
+					Description: fmt.Sprintf("%g%% of fees collected - %s", rule.Percent, b.BatchName),
+					Quantity:    collected,
+					Rate:        rule.Percent / 100,
+					Amount:      round2(collected * rule.Percent / 100),
+				})
+			}
+		}
+	}
+
+	for _, l := range slip.Lines {
+		slip.Total += l.Amount
+	}
+	slip.Total = round2(slip.Total)
+	return slip, nil
+}
+
+// ruleBatches are the batches a rule pays for: its own batch, or every batch
+// the staff member teaches
+func ruleBatches(ctx context.Context, staffID string, rule models.PayRule) ([]models.Batch, error) {
+	if rule.Type == models.PayFixed {
+		return nil, nil
+	}
+	if rule.BatchID == "" {
+		return teacherBatches(ctx, staffID)
+	}
+
+	objID, err := primitive.ObjectIDFromHex(rule.BatchID)
+	if err != nil {
+		return nil, nil
+	}
+	var batch models.Batch
+	if err := database.DB.Collection("batches").FindOne(ctx, bson.M{"_id": objID}).Decode(&batch); err != nil {
+		return nil, nil
+	}
+	return []models.Batch{batch}, nil
+}
+
+// classesHeld counts the batch's attendance sessions in a month in which
+// at least one student was marked
+func classesHeld(ctx context.Context, batchID, month string) (int64, error) {
+	return database.DB.Collection("attendance").CountDocuments(ctx, bson.M{
+		"batch_id":       batchID,
+		"date":           bson.M{"$regex": "^" + month},
+		"records.status": bson.M{"$in": bson.A{models.AttendancePresent, models.AttendanceLate, models.AttendanceAbsent}},
+	})
+}
+
+// feesCollected sums the batch's payments for a month. A payment covering
+// several months counts an equal share towards each.
+func feesCollected(ctx context.Context, batchID, month string) (float64, error) {
+	cursor, err := database.DB.Collection("payments").Find(ctx, bson.M{
+		"$or":    bson.A{bson.M{"batch_id": batchID}, bson.M{"lines.batch_id": batchID}},
+		"months": month,
+		"void":   false,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, p := range payments {
+		// Fee lines say which enrolment's batch they are for; older
+		// payments are all for the batch on the payment
+		perLine := false
+		for _, l := range p.Lines {
+			if l.BatchID == "" {
+				continue
+			}
+			perLine = true
+			if l.Kind == models.LineFee && l.BatchID == batchID {
+				total += l.Amount
+			}
+		}
+		if !perLine && p.BatchID == batchID && len(p.Months) > 0 {
+			total += p.Amount / float64(len(p.Months))
+		}
+	}
+	return round2(total), nil
+}
+
+func loadPayRules(ctx context.Context, filter bson.M) ([]models.PayRule, error) {
+	cursor, err := database.DB.Collection("pay_rules").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	rules := []models.PayRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func loadPayslips(ctx context.Context, month string) ([]models.Payslip, error) {
+	filter := bson.M{}
+	if month != "" {
+		filter["month"] = month
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "month", Value: -1}, {Key: "staff_name", Value: 1}})
+	cursor, err := database.DB.Collection("payslips").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	payslips := []models.Payslip{}
+	if err := cursor.All(ctx, &payslips); err != nil {
+		return nil, err
+	}
+	return payslips, nil
+}
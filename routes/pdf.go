@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Name printed on top of every generated document
+func centreName() string {
+	if name := os.Getenv("CENTRE_NAME"); name != "" {
+		return name
+	}
+	return "Coaching Centre"
+}
+
+// newPDF starts an A4 portrait document with the centre header and a title
+func newPDF(title string) *fpdf.Fpdf {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+	pdfHeader(pdf, title)
+	return pdf
+}
+
+// pdfHeader writes the centre name, optional address and a document title
+func pdfHeader(pdf *fpdf.Fpdf, title string) {
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 9, centreName(), "", 1, "C", false, 0, "")
+
+	if address := os.Getenv("CENTRE_ADDRESS"); address != "" {
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, 5, address, "", 1, "C", false, 0, "")
+	}
+
+	pdf.SetFont("Helvetica", "B", 13)
+	pdf.CellFormat(0, 9, title, "B", 1, "C", false, 0, "")
+	pdf.Ln(4)
+}
+
+// pdfField writes a "Label: value" line
+func pdfField(pdf *fpdf.Fpdf, label, value string) {
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(40, 7, label+":", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.CellFormat(0, 7, value, "", 1, "L", false, 0, "")
+}
+
+// pdfTable writes a simple bordered table; widths are in mm
+func pdfTable(pdf *fpdf.Fpdf, headers []string, widths []float64, rows [][]string) {
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.SetFillColor(230, 230, 230)
+	for i, h := range headers {
+		pdf.CellFormat(widths[i], 8, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 10)
+	for _, row := range rows {
+		for i, v := range row {
+			align := "C"
+			if i < len(widths) && widths[i] >= 40 {
+				align = "L"
+			}
+			pdf.CellFormat(widths[i], 7, v, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+}
+
+func pdfBytes(pdf *fpdf.Fpdf) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendPDF streams a finished document as a download
+func sendPDF(c *fiber.Ctx, pdf *fpdf.Fpdf, filename string) error {
+	data, err := pdfBytes(pdf)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to generate PDF"})
+	}
+
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	return c.Send(data)
+}
+
+// pdfStamp writes a large faded word such as VOID across the page
+func pdfStamp(pdf *fpdf.Fpdf, word string) {
+	pdf.SetFont("Helvetica", "B", 110)
+	pdf.SetTextColor(200, 0, 0)
+	pdf.SetAlpha(0.25, "Normal")
+	pdf.TransformBegin()
+	pdf.TransformRotate(30, 105, 150)
+	pdf.Text(105-pdf.GetStringWidth(word)/2, 170, word)
+	pdf.TransformEnd()
+	pdf.SetAlpha(1, "Normal")
+	pdf.SetTextColor(0, 0, 0)
+}
@@ -0,0 +1,247 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ProfitLossMonth is one month of the profit-and-loss report
+type ProfitLossMonth struct {
+	Month    string             `json:"month"`
+	Income   float64            `json:"income"`
+	Refunds  float64            `json:"refunds"`
+	Expenses map[string]float64 `json:"expenses"` // by category
+	Total    float64            `json:"total_expenses"`
+	Net      float64            `json:"net_profit"`
+}
+
+// ProfitLoss is the report for ?from=&to= months
+type ProfitLoss struct {
+	From     string             `json:"from"`
+	To       string             `json:"to"`
+	Months   []ProfitLossMonth  `json:"months"`
+	Income   float64            `json:"income"`
+	Refunds  float64            `json:"refunds"`
+	Expenses map[string]float64 `json:"expenses"`
+	Total    float64            `json:"total_expenses"`
+	Net      float64            `json:"net_profit"`
+}
+
+// GetProfitLoss reports fee income against expenses for each month from
+// ?from= to ?to= (YYYY-MM, default this year so far). Money is counted in
+// the month it changed hands: payments by when they were taken, cash
+// refunds by when they were approved, paid payslips as salaries by when
+// they were paid out.
+func GetProfitLoss(c *fiber.Ctx) error {
+	from, to, err := reportMonths(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildProfitLoss(ctx, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build report"})
+	}
+	return c.JSON(report)
+}
+
+// ExportProfitLoss streams the same report as an Excel sheet with a column
+// per month
+func ExportProfitLoss(c *fiber.Ctx) error {
+	from, to, err := reportMonths(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	report, err := buildProfitLoss(ctx, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build report"})
+	}
+
+	f := excelize.NewFile()
+	sheet := "Profit and Loss"
+	f.SetSheetName(f.GetSheetName(0), sheet)
+
+	// One column per month, then the total
+	for i, m := range report.Months {
+		start, _, _ := monthBounds(m.Month)
+		cellName, _ := excelize.CoordinatesToCellName(i+2, 1)
+		f.SetCellValue(sheet, cellName, start.Format("Jan 2006"))
+	}
+	totalCol := len(report.Months) + 2
+	cellName, _ := excelize.CoordinatesToCellName(totalCol, 1)
+	f.SetCellValue(sheet, cellName, "Total")
+
+	writeRow := func(row int, label string, value func(ProfitLossMonth) float64, total float64) {
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), label)
+		for i, m := range report.Months {
+			cellName, _ := excelize.CoordinatesToCellName(i+2, row)
+			f.SetCellValue(sheet, cellName, value(m))
+		}
+		cellName, _ := excelize.CoordinatesToCellName(totalCol, row)
+		f.SetCellValue(sheet, cellName, total)
+	}
+
+	row := 2
+	writeRow(row, "Fee income", func(m ProfitLossMonth) float64 { return m.Income }, report.Income)
+	row++
+	writeRow(row, "Refunds", func(m ProfitLossMonth) float64 { return -m.Refunds }, -report.Refunds)
+	row += 2
+
+	f.SetCellValue(sheet, fmt.Sprintf("A%d", row), "Expenses")
+	row++
+	for _, category := range models.ExpenseCategories {
+		writeRow(row, "  "+category, func(m ProfitLossMonth) float64 { return m.Expenses[category] }, report.Expenses[category])
+		row++
+	}
+	writeRow(row, "Total expenses", func(m ProfitLossMonth) float64 { return m.Total }, report.Total)
+	row += 2
+	writeRow(row, "Net profit", func(m ProfitLossMonth) float64 { return m.Net }, report.Net)
+
+	f.SetColWidth(sheet, "A", "A", 20)
+
+	c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"profit_loss_%s_%s.xlsx\"", from, to))
+	buf, _ := f.WriteToBuffer()
+	return c.SendStream(buf)
+}
+
+// reportMonths reads ?from=&to= (YYYY-MM); from defaults to January, to to
+// the current month
+func reportMonths(c *fiber.Ctx) (string, string, error) {
+	now := time.Now().In(centreLocation())
+	from := c.Query("from", fmt.Sprintf("%d-01", now.Year()))
+	to := c.Query("to", now.Format(monthLayout))
+
+	start, _, err := monthBounds(from)
+	if err != nil {
+		return "", "", fmt.Errorf("from must be YYYY-MM")
+	}
+	end, _, err := monthBounds(to)
+	if err != nil {
+		return "", "", fmt.Errorf("to must be YYYY-MM")
+	}
+	if end.Before(start) {
+		return "", "", fmt.Errorf("to is before from")
+	}
+	return from, to, nil
+}
+
+func buildProfitLoss(ctx context.Context, from, to string) (*ProfitLoss, error) {
+	start, _, _ := monthBounds(from)
+	_, end, _ := monthBounds(to)
+
+	report := &ProfitLoss{From: from, To: to, Expenses: map[string]float64{}}
+	index := map[string]int{}
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		index[m.Format(monthLayout)] = len(report.Months)
+		report.Months = append(report.Months, ProfitLossMonth{Month: m.Format(monthLayout), Expenses: map[string]float64{}})
+	}
+
+	// Fee income
+	cursor, err := database.DB.Collection("payments").Find(ctx, bson.M{
+		"void":    false,
+		"paid_at": bson.M{"$gte": start, "$lt": end},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if i, ok := index[p.PaidAt.In(centreLocation()).Format(monthLayout)]; ok {
+			report.Months[i].Income += p.Amount
+		}
+	}
+
+	// Cash refunds; credit notes already show as smaller payments
+	var refunds []models.Refund
+	filter := bson.M{"kind": models.RefundCash, "status": models.RefundApproved, "decided_at": bson.M{"$gte": start, "$lt": end}}
+	if err := findAll(ctx, "refunds", filter, &refunds); err != nil {
+		return nil, err
+	}
+	for _, r := range refunds {
+		if i, ok := index[r.DecidedAt.In(centreLocation()).Format(monthLayout)]; ok {
+			report.Months[i].Refunds += r.Amount
+		}
+	}
+
+	// Recorded expenses
+	cursor, err = database.DB.Collection("expenses").Find(ctx, bson.M{
+		"date": bson.M{"$gte": start.Format(dateLayout), "$lt": end.Format(dateLayout)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var expenses []models.Expense
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	for _, e := range expenses {
+		if i, ok := index[e.Date[:len(monthLayout)]]; ok {
+			report.Months[i].Expenses[e.Category] += e.Amount
+		}
+	}
+
+	// Salaries paid through payroll
+	cursor, err = database.DB.Collection("payslips").Find(ctx, bson.M{
+		"paid":    true,
+		"paid_at": bson.M{"$gte": start, "$lt": end},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var payslips []models.Payslip
+	if err := cursor.All(ctx, &payslips); err != nil {
+		return nil, err
+	}
+	for _, p := range payslips {
+		if p.PaidAt == nil {
+			continue
+		}
+		if i, ok := index[p.PaidAt.In(centreLocation()).Format(monthLayout)]; ok {
+			report.Months[i].Expenses[models.ExpenseSalaries] += p.Total
+		}
+	}
+
+	for i := range report.Months {
+		m := &report.Months[i]
+		for category, amount := range m.Expenses {
+			m.Expenses[category] = round2(amount)
+			m.Total += amount
+			report.Expenses[category] += amount
+		}
+		m.Income = round2(m.Income)
+		m.Refunds = round2(m.Refunds)
+		m.Total = round2(m.Total)
+		m.Net = round2(m.Income - m.Refunds - m.Total)
+
+		report.Income += m.Income
+		report.Refunds += m.Refunds
+		report.Total += m.Total
+	}
+	for category, amount := range report.Expenses {
+		report.Expenses[category] = round2(amount)
+	}
+	report.Income = round2(report.Income)
+	report.Refunds = round2(report.Refunds)
+	report.Total = round2(report.Total)
+	report.Net = round2(report.Income - report.Refunds - report.Total)
+
+	return report, nil
+}
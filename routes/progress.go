@@ -0,0 +1,266 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ExamProgress is one row of a student's progress history
+type ExamProgress struct {
+	ExamID        string    `json:"exam_id"`
+	Exam          string    `json:"exam"`
+	Date          time.Time `json:"date"`
+	Subject       string    `json:"subject"`
+	CQ            string    `json:"cq"`
+	MCQ           string    `json:"mcq"`
+	Total         int       `json:"total"`
+	FullMarks     float64   `json:"full_marks"`
+	Percentage    float64   `json:"percentage"`
+	Rank          int       `json:"rank"`
+	OutOf         int       `json:"out_of"`
+	RankChange    int       `json:"rank_change"`
+	MovingAverage float64   `json:"moving_average"`
+	Drop          bool      `json:"drop"`
+	Absent        bool      `json:"absent"`
+}
+
+// StudentProgress is the response of GET /student/:id/progress
+type StudentProgress struct {
+	Student       models.Student `json:"student"`
+	Exams         []ExamProgress `json:"exams"`
+	Average       float64        `json:"average"`
+	BestRank      int            `json:"best_rank"`
+	LatestRank    int            `json:"latest_rank"`
+	Trend         string         `json:"trend"`
+	Drops         int            `json:"drops"`
+	Window        int            `json:"window"`
+	DropThreshold float64        `json:"drop_threshold"`
+}
+
+// GetStudentProgress returns a student's results across all exams.
+// Optional ?window= sets the moving average size (default 3) and
+// ?drop= the percentage point fall that gets flagged (default 10).
+func GetStudentProgress(c *fiber.Ctx) error {
+	progress, status, err := loadStudentProgress(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(progress)
+}
+
+// ExportStudentProgress streams the same progress report as an Excel file
+func ExportStudentProgress(c *fiber.Ctx) error {
+	progress, status, err := loadStudentProgress(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	f := excelize.NewFile()
+	sheet := "Progress"
+	f.SetSheetName(f.GetSheetName(0), sheet)
+
+	f.SetCellValue(sheet, "A1", "Name")
+	f.SetCellValue(sheet, "B1", progress.Student.Name)
+	f.SetCellValue(sheet, "A2", "Class")
+	f.SetCellValue(sheet, "B2", progress.Student.Class)
+	f.SetCellValue(sheet, "A3", "Average %")
+	f.SetCellValue(sheet, "B3", progress.Average)
+	f.SetCellValue(sheet, "A4", "Trend")
+	f.SetCellValue(sheet, "B4", progress.Trend)
+
+	headers := []string{"Date", "Exam", "Subject", "CQ", "MCQ", "Total", "Full Marks", "Percentage", "Rank", "Out Of", "Moving Avg", "Flag"}
+	for i, h := range headers {
+		col := string(rune('A' + i))
+		f.SetCellValue(sheet, col+"6", h)
+	}
+
+	for i, e := range progress.Exams {
+		row := i + 7
+		flag := ""
+		if e.Drop {
+			flag = "DROP"
+		}
+		if e.Absent {
+			flag = "ABSENT"
+		}
+		f.SetCellValue(sheet, fmt.Sprintf("A%d", row), e.Date.Format("02-Jan-2006"))
+		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), e.Exam)
+		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), e.Subject)
+		f.SetCellValue(sheet, fmt.Sprintf("D%d", row), e.CQ)
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), e.MCQ)
+		f.SetCellValue(sheet, fmt.Sprintf("F%d", row), e.Total)
+		f.SetCellValue(sheet, fmt.Sprintf("G%d", row), e.FullMarks)
+		f.SetCellValue(sheet, fmt.Sprintf("H%d", row), e.Percentage)
+		f.SetCellValue(sheet, fmt.Sprintf("I%d", row), e.Rank)
+		f.SetCellValue(sheet, fmt.Sprintf("J%d", row), e.OutOf)
+		f.SetCellValue(sheet, fmt.Sprintf("K%d", row), e.MovingAverage)
+		f.SetCellValue(sheet, fmt.Sprintf("L%d", row), flag)
+	}
+
+	filename := fmt.Sprintf("progress_%s.xlsx", safeFilename(progress.Student.Name))
+	c.Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	buf, _ := f.WriteToBuffer()
+	return c.SendStream(buf)
+}
+
+// loadStudentProgress fetches the student with their results and exams.
+// It returns the HTTP status to use when something goes wrong.
+func loadStudentProgress(c *fiber.Ctx) (*StudentProgress, int, error) {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("Invalid ID")
+	}
+
+	window, err := strconv.Atoi(c.Query("window", "3"))
+	if err != nil || window < 1 {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("window must be a positive number")
+	}
+
+	threshold, err := strconv.ParseFloat(c.Query("drop", "10"), 64)
+	if err != nil || threshold <= 0 {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("drop must be a positive number")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var student models.Student
+	if err := database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student); err != nil {
+		return nil, fiber.StatusNotFound, fmt.Errorf("Student not found")
+	}
+
+	cursor, err := database.DB.Collection("results").Find(ctx, bson.M{"student_id": objID.Hex()})
+	if err != nil {
+		return nil, fiber.StatusInternalServerError, fmt.Errorf("Cannot fetch results")
+	}
+	var results []models.Result
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fiber.StatusInternalServerError, fmt.Errorf("Cannot parse results")
+	}
+
+	examIDs := make([]primitive.ObjectID, 0, len(results))
+	for _, r := range results {
+		examIDs = append(examIDs, r.ExamID)
+	}
+
+	exams := make(map[primitive.ObjectID]models.Exam)
+	if len(examIDs) > 0 {
+		cursor, err = database.DB.Collection("exams").Find(ctx, bson.M{"_id": bson.M{"$in": examIDs}})
+		if err != nil {
+			return nil, fiber.StatusInternalServerError, fmt.Errorf("Cannot fetch exams")
+		}
+		var list []models.Exam
+		if err := cursor.All(ctx, &list); err != nil {
+			return nil, fiber.StatusInternalServerError, fmt.Errorf("Cannot parse exams")
+		}
+		for _, e := range list {
+			exams[e.ID] = e
+		}
+	}
+
+	progress := buildProgress(results, exams, window, threshold)
+	progress.Student = student
+	return progress, fiber.StatusOK, nil
+}
+
+// buildProgress orders the results by exam date and works out the
+// percentages, moving average, rank changes and drop flags
+func buildProgress(results []models.Result, exams map[primitive.ObjectID]models.Exam, window int, threshold float64) *StudentProgress {
+	progress := &StudentProgress{Exams: []ExamProgress{}, Window: window, DropThreshold: threshold, Trend: "stable"}
+
+	for _, r := range results {
+		exam, ok := exams[r.ExamID]
+		if !ok {
+			continue
+		}
+		fullMarks := exam.FullMarks
+		if fullMarks <= 0 {
+			fullMarks = 100
+		}
+		progress.Exams = append(progress.Exams, ExamProgress{
+			ExamID:     exam.ID.Hex(),
+			Exam:       exam.Name,
+			Date:       exam.Date,
+			Subject:    exam.Subject,
+			CQ:         r.CQ,
+			MCQ:        r.MCQ,
+			Total:      r.Total,
+			FullMarks:  fullMarks,
+			Percentage: round2(float64(r.Total) / fullMarks * 100),
+			Rank:       r.Rank,
+			OutOf:      exam.Participants,
+			Absent:     r.Absent,
+		})
+	}
+
+	sort.Slice(progress.Exams, func(i, j int) bool {
+		return progress.Exams[i].Date.Before(progress.Exams[j].Date)
+	})
+
+	// Exams the student missed are listed but left out of the averages,
+	// ranks and drops, a missed exam isn't a mark of 0
+	sum := 0.0
+	var sat []*ExamProgress
+	for i := range progress.Exams {
+		e := &progress.Exams[i]
+		if e.Absent {
+			continue
+		}
+		sat = append(sat, e)
+		sum += e.Percentage
+
+		recent := sat[max(0, len(sat)-window):]
+		windowSum := 0.0
+		for _, w := range recent {
+			windowSum += w.Percentage
+		}
+		e.MovingAverage = round2(windowSum / float64(len(recent)))
+
+		if len(sat) > 1 {
+			prev := sat[len(sat)-2]
+			e.RankChange = prev.Rank - e.Rank
+			if prev.Percentage-e.Percentage >= threshold {
+				e.Drop = true
+				progress.Drops++
+			}
+		}
+
+		if progress.BestRank == 0 || e.Rank < progress.BestRank {
+			progress.BestRank = e.Rank
+		}
+		progress.LatestRank = e.Rank
+	}
+
+	if n := len(sat); n > 0 {
+		progress.Average = round2(sum / float64(n))
+
+		// Compare the latest moving average with the one a window earlier
+		if n > window {
+			diff := sat[n-1].MovingAverage - sat[n-1-window].MovingAverage
+			if diff >= threshold/2 {
+				progress.Trend = "improving"
+			} else if diff <= -threshold/2 {
+				progress.Trend = "declining"
+			}
+		}
+	}
+
+	return progress
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
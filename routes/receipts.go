@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetPayments lists ledger payments, newest first, optionally for one
+// ?student_id= or ?receipt_no=
+func GetPayments(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if studentID := c.Query("student_id"); studentID != "" {
+		filter["student_id"] = studentID
+	}
+	if receiptNo := c.Query("receipt_no"); receiptNo != "" {
+		filter["receipt_no"] = receiptNo
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"paid_at": -1})
+	cursor, err := database.DB.Collection("payments").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payments"})
+	}
+
+	payments := []models.Payment{}
+	if err := cursor.All(ctx, &payments); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse payments"})
+	}
+	return c.JSON(payments)
+}
+
+// PaymentReceiptPDF prints (or reprints) the money receipt of a payment
+func PaymentReceiptPDF(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var payment models.Payment
+	if err := database.DB.Collection("payments").FindOne(ctx, bson.M{"_id": objID}).Decode(&payment); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+
+	pdf := newPDF("Money Receipt")
+	writeReceipt(pdf, payment, batchName(ctx, payment.BatchID))
+
+	return sendPDF(c, pdf, fmt.Sprintf("receipt_%s.pdf", safeFilename(payment.ReceiptNo)))
+}
+
+func writeReceipt(pdf *fpdf.Fpdf, p models.Payment, batch string) {
+	loc := centreLocation()
+
+	pdfField(pdf, "Receipt No", p.ReceiptNo)
+	pdfField(pdf, "Date", p.PaidAt.In(loc).Format("02 January 2006"))
+	pdf.Ln(3)
+	pdfField(pdf, "Received from", p.StudentName)
+	pdfField(pdf, "Class", p.Class)
+	pdfField(pdf, "Subject", p.Subject)
+	if batch != "" {
+		pdfField(pdf, "Batch", batch)
+	}
+	pdfField(pdf, "For", receiptPeriod(p.Months))
+	pdf.Ln(3)
+	if len(p.Lines) > 0 {
+		rows := [][]string{}
+		for _, l := range p.Lines {
+			rows = append(rows, []string{l.Description, formatTaka(l.Amount)})
+		}
+		pdfTable(pdf, []string{"Item", "Amount (Tk)"}, []float64{140, 40}, rows)
+		pdf.Ln(3)
+	}
+	pdfField(pdf, "Amount", "Tk "+formatTaka(p.Amount))
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(40, 7, "In words:", "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, 7, amountInWords(p.Amount), "", "L", false)
+	pdf.Ln(3)
+	pdfField(pdf, "Paid by", methodName(p.Method))
+	if p.TransactionID != "" {
+		pdfField(pdf, "Transaction ID", p.TransactionID)
+	}
+	if p.SenderNumber != "" {
+		pdfField(pdf, "Sender", p.SenderNumber)
+	}
+	collector := p.CollectedBy
+	if collector == "" {
+		collector = "-"
+	}
+	pdfField(pdf, "Collected by", collector)
+
+	pdf.Ln(20)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(60, 6, "Signature", "T", 1, "C", false, 0, "")
+
+	if p.Void {
+		voided := ""
+		if p.VoidedAt != nil {
+			voided = " on " + p.VoidedAt.In(loc).Format("02 January 2006")
+		}
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(0, 7, "This receipt was voided"+voided+" and is not valid.", "", 1, "L", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+		pdfStamp(pdf, "VOID")
+	}
+}
+
+// methodName is how a payment method is printed. Payments from before
+// methods were recorded were all cash.
+func methodName(method string) string {
+	switch method {
+	case models.MethodBkash:
+		return "bKash"
+	case models.MethodNagad:
+		return "Nagad"
+	case models.MethodBank:
+		return "Bank transfer"
+	}
+	return "Cash"
+}
+
+// receiptPeriod lists the months a payment covers, e.g. "January 2026, February 2026"
+func receiptPeriod(months []string) string {
+	var names []string
+	for _, m := range months {
+		if start, _, err := monthBounds(m); err == nil {
+			names = append(names, start.Format("January 2006"))
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ", ")
+}
+
+// formatTaka writes an amount with lakh grouping, e.g. 1,25,000.00
+func formatTaka(amount float64) string {
+	s := fmt.Sprintf("%.2f", math.Abs(amount))
+	whole, fraction := s[:len(s)-3], s[len(s)-3:]
+
+	var groups []string
+	if len(whole) > 3 {
+		groups = append([]string{whole[len(whole)-3:]}, groups...)
+		whole = whole[:len(whole)-3]
+		for len(whole) > 2 {
+			groups = append([]string{whole[len(whole)-2:]}, groups...)
+			whole = whole[:len(whole)-2]
+		}
+	}
+	groups = append([]string{whole}, groups...)
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+	return sign + strings.Join(groups, ",") + fraction
+}
+
+var (
+	wordOnes = []string{"", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine",
+		"Ten", "Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	wordTens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+// amountInWords spells an amount the way receipts here do, e.g.
+// "Taka One Lakh Twenty Five Thousand and Fifty Paisa Only"
+func amountInWords(amount float64) string {
+	paisaTotal := int64(math.Round(math.Abs(amount) * 100))
+	taka, paisa := paisaTotal/100, paisaTotal%100
+
+	words := "Zero"
+	if taka > 0 {
+		words = numberInWords(taka)
+	}
+	words = "Taka " + words
+	if paisa > 0 {
+		words += " and " + numberInWords(paisa) + " Paisa"
+	}
+	return words + " Only"
+}
+
+// numberInWords spells n using crore, lakh, thousand and hundred
+func numberInWords(n int64) string {
+	var parts []string
+	for _, unit := range []struct {
+		size int64
+		name string
+	}{{10000000, "Crore"}, {100000, "Lakh"}, {1000, "Thousand"}, {100, "Hundred"}} {
+		if n >= unit.size {
+			parts = append(parts, numberInWords(n/unit.size)+" "+unit.name)
+			n %= unit.size
+		}
+	}
+	switch {
+	case n >= 20:
+		word := wordTens[n/10]
+		if n%10 > 0 {
+			word += " " + wordOnes[n%10]
+		}
+		parts = append(parts, word)
+	case n > 0:
+		parts = append(parts, wordOnes[n])
+	}
+	return strings.Join(parts, " ")
+}
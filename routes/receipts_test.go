@@ -0,0 +1,43 @@
+package routes
+
+import "testing"
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "Taka Zero Only"},
+		{0.5, "Taka Zero and Fifty Paisa Only"},
+		{15, "Taka Fifteen Only"},
+		{1500, "Taka One Thousand Five Hundred Only"},
+		{125050, "Taka One Lakh Twenty Five Thousand Fifty Only"},
+		{1234.75, "Taka One Thousand Two Hundred Thirty Four and Seventy Five Paisa Only"},
+		{10000000, "Taka One Crore Only"},
+		{25300000.01, "Taka Two Crore Fifty Three Lakh and One Paisa Only"},
+	}
+	for _, tt := range tests {
+		if got := amountInWords(tt.amount); got != tt.want {
+			t.Errorf("amountInWords(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTaka(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{0, "0.00"},
+		{999, "999.00"},
+		{1500, "1,500.00"},
+		{125050.5, "1,25,050.50"},
+		{10000000, "1,00,00,000.00"},
+		{-2500.25, "-2,500.25"},
+	}
+	for _, tt := range tests {
+		if got := formatTaka(tt.amount); got != tt.want {
+			t.Errorf("formatTaka(%v) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
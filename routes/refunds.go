@@ -0,0 +1,289 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RefundRequest is the body of POST /api/refunds
+type RefundRequest struct {
+	PaymentID string  `json:"payment_id"`
+	Kind      string  `json:"kind"` // refund or credit_note
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason"`
+}
+
+var errRefundDecided = errors.New("refund already decided")
+
+// studentCredit is what is left of an approved credit note
+type studentCredit struct {
+	Refund    models.Refund
+	Remaining float64
+}
+
+// GetRefunds lists refunds and credit notes, optionally filtered by
+// ?student_id=, ?payment_id= and ?status=
+func GetRefunds(c *fiber.Ctx) error {
+	filter := bson.M{}
+	for _, key := range []string{"student_id", "payment_id", "status"} {
+		if v := c.Query(key); v != "" {
+			filter[key] = v
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"requested_at": -1})
+	cursor, err := database.DB.Collection("refunds").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch refunds"})
+	}
+
+	refunds := []models.Refund{}
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse refunds"})
+	}
+	return c.JSON(refunds)
+}
+
+// RequestRefund asks for money back against a payment. It stays pending
+// until an admin approves it.
+func RequestRefund(c *fiber.Ctx) error {
+	var req RefundRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.Kind != models.RefundCash && req.Kind != models.CreditNote {
+		return c.Status(400).JSON(fiber.Map{"error": "kind must be refund or credit_note"})
+	}
+	if req.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "amount must be more than 0"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "reason is required"})
+	}
+	paymentID, err := primitive.ObjectIDFromHex(req.PaymentID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid payment ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var payment models.Payment
+	if err := database.DB.Collection("payments").FindOne(ctx, bson.M{"_id": paymentID}).Decode(&payment); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Payment not found"})
+	}
+	if payment.Void {
+		return c.Status(400).JSON(fiber.Map{"error": "Payment is void"})
+	}
+
+	refundable, err := refundableAmount(ctx, payment)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check earlier refunds"})
+	}
+	if req.Amount > refundable {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("only %.2f of this payment can still be refunded", refundable)})
+	}
+
+	refund := models.Refund{
+		ID:          primitive.NewObjectID(),
+		Kind:        req.Kind,
+		PaymentID:   payment.ID.Hex(),
+		ReceiptNo:   payment.ReceiptNo,
+		StudentID:   payment.StudentID,
+		StudentName: payment.StudentName,
+		BatchID:     payment.BatchID,
+		Amount:      round2(req.Amount),
+		Reason:      req.Reason,
+		Status:      models.RefundPending,
+		RequestedBy: auth.CurrentUser(c),
+		RequestedAt: time.Now(),
+	}
+
+	if _, err := database.DB.Collection("refunds").InsertOne(ctx, refund); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert refund"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(refund)
+}
+
+// ApproveRefund lets an admin approve a pending refund: {"note": "..."}.
+// It gets its number (RF- or CN- per financial year) on approval.
+func ApproveRefund(c *fiber.Ctx) error {
+	return decideRefund(c, models.RefundApproved)
+}
+
+// RejectRefund lets an admin turn a pending refund down: {"note": "..."}
+func RejectRefund(c *fiber.Ctx) error {
+	return decideRefund(c, models.RefundRejected)
+}
+
+func decideRefund(c *fiber.Ctx, status string) error {
+	if !auth.IsAdmin(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only an admin can approve or reject refunds"})
+	}
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.DB.Collection("refunds")
+	var refund models.Refund
+	if err := collection.FindOne(ctx, bson.M{"_id": objID}).Decode(&refund); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Refund not found"})
+	}
+	if refund.Status != models.RefundPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Refund is already " + refund.Status})
+	}
+
+	now := time.Now()
+	refund.Status = status
+	refund.DecidedBy = auth.CurrentUser(c)
+	refund.DecidedAt = &now
+	refund.DecisionNote = req.Note
+
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if status == models.RefundApproved {
+			prefix := "RF"
+			if refund.Kind == models.CreditNote {
+				prefix = "CN"
+			}
+			year := financialYear(now)
+			seq, err := nextSequence(sc, refund.Kind+":"+year)
+			if err != nil {
+				return err
+			}
+			refund.Number = fmt.Sprintf("%s-%s-%05d", prefix, year, seq)
+		}
+
+		// Only a still-pending refund is decided, in case two admins click at once
+		res, err := collection.ReplaceOne(sc, bson.M{"_id": objID, "status": models.RefundPending}, refund)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return errRefundDecided
+		}
+		if status == models.RefundApproved && refund.Kind == models.RefundCash {
+			return refreshDayClose(sc, now)
+		}
+		return nil
+	})
+	if errors.Is(err, errRefundDecided) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Refund was already decided"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update refund"})
+	}
+
+	return c.JSON(refund)
+}
+
+// hasRefunds reports whether a payment has refunds or credit notes that
+// weren't rejected. Such a payment can't be voided: the refund would stay
+// in the cash book and the income would be reversed twice.
+func hasRefunds(ctx context.Context, paymentID string) (bool, error) {
+	n, err := database.DB.Collection("refunds").CountDocuments(ctx, bson.M{
+		"payment_id": paymentID,
+		"status":     bson.M{"$ne": models.RefundRejected},
+	})
+	return n > 0, err
+}
+
+// refundableAmount is what is left of a payment after the refunds and
+// credit notes not rejected
+func refundableAmount(ctx context.Context, payment models.Payment) (float64, error) {
+	cursor, err := database.DB.Collection("refunds").Find(ctx, bson.M{
+		"payment_id": payment.ID.Hex(),
+		"status":     bson.M{"$ne": models.RefundRejected},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var refunds []models.Refund
+	if err := cursor.All(ctx, &refunds); err != nil {
+		return 0, err
+	}
+
+	left := payment.Amount
+	for _, r := range refunds {
+		left -= r.Amount
+	}
+	return round2(left), nil
+}
+
+// studentCredits lists a student's approved credit notes with something
+// left on them, oldest first. What was spent is read back from the credit
+// lines of payments that aren't void.
+func studentCredits(ctx context.Context, studentID string) ([]studentCredit, error) {
+	opts := options.Find().SetSort(bson.M{"decided_at": 1})
+	cursor, err := database.DB.Collection("refunds").Find(ctx, bson.M{
+		"student_id": studentID,
+		"kind":       models.CreditNote,
+		"status":     models.RefundApproved,
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var notes []models.Refund
+	if err := cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, nil
+	}
+
+	cursor, err = database.DB.Collection("payments").Find(ctx, bson.M{
+		"student_id": studentID,
+		"void":       false,
+		"lines.kind": models.LineCredit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var payments []models.Payment
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	spent := map[string]float64{}
+	for _, p := range payments {
+		for _, l := range p.Lines {
+			if l.Kind == models.LineCredit {
+				spent[l.RefundID] -= l.Amount
+			}
+		}
+	}
+
+	var credits []studentCredit
+	for _, n := range notes {
+		if left := round2(n.Amount - spent[n.ID.Hex()]); left > 0 {
+			credits = append(credits, studentCredit{Refund: n, Remaining: left})
+		}
+	}
+	return credits, nil
+}
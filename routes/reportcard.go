@@ -0,0 +1,363 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetExams lists saved exams, newest first. ?batch_id= narrows it down.
+func GetExams(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if batchID := c.Query("batch_id"); batchID != "" {
+		filter["batch_id"] = batchID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"date": -1})
+	cursor, err := database.DB.Collection("exams").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch exams"})
+	}
+	defer cursor.Close(ctx)
+
+	exams := []models.Exam{}
+	if err := cursor.All(ctx, &exams); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse exams"})
+	}
+
+	return c.JSON(exams)
+}
+
+// ReportCardPDF downloads one student's report card for an exam
+func ReportCardPDF(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exam, results, err := loadExamResults(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	studentID := c.Params("studentId")
+	for _, r := range results {
+		if r.StudentID == studentID {
+			pdf := newPDF("Report Card")
+			writeReportCard(ctx, pdf, exam, r)
+			return sendPDF(c, pdf, reportCardFilename(exam, r))
+		}
+	}
+
+	return c.Status(404).JSON(fiber.Map{"error": "No result for this student in the exam"})
+}
+
+// ReportCardsZip downloads every report card of an exam as a zip
+func ReportCardsZip(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	exam, results, err := loadExamResults(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if err := zipReportCards(ctx, zw, "", exam, results); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build zip"})
+	}
+	if err := zw.Close(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build zip"})
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"report_cards_%s.zip\"", safeFilename(exam.Name)))
+	return c.Send(buf.Bytes())
+}
+
+// BatchReportCardsZip downloads the report cards of every exam of a batch
+// as one zip, a folder per exam. ?from= and ?to= (YYYY-MM-DD) limit the
+// exam dates.
+func BatchReportCardsZip(c *fiber.Ctx) error {
+	filter := bson.M{"batch_id": c.Params("id")}
+	dates := bson.M{}
+	for key, op := range map[string]string{"from": "$gte", "to": "$lt"} {
+		v := c.Query(key)
+		if v == "" {
+			continue
+		}
+		d, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": key + " must be YYYY-MM-DD"})
+		}
+		if key == "to" {
+			d = d.AddDate(0, 0, 1)
+		}
+		dates[op] = d
+	}
+	if len(dates) > 0 {
+		filter["date"] = dates
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var exams []models.Exam
+	if err := findAll(ctx, "exams", filter, &exams); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch exams"})
+	}
+	if len(exams) == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "No exams for this batch"})
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, exam := range exams {
+		_, results, err := loadExamResults(ctx, exam.ID.Hex())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		// Two exams can share a day and a name, so the ID keeps them apart
+		folder := exam.Date.Format(dateLayout) + "_" + safeFilename(exam.Name) + "_" + exam.ID.Hex() + "/"
+		if err := zipReportCards(ctx, zw, folder, exam, results); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to build zip"})
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build zip"})
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"report_cards_%s.zip\"", safeFilename(batchName(ctx, c.Params("id")))))
+	return c.Send(buf.Bytes())
+}
+
+// zipReportCards adds a report card for each result to the zip, under folder
+func zipReportCards(ctx context.Context, zw *zip.Writer, folder string, exam models.Exam, results []models.Result) error {
+	for _, r := range results {
+		pdf := newPDF("Report Card")
+		writeReportCard(ctx, pdf, exam, r)
+		data, err := pdfBytes(pdf)
+		if err != nil {
+			return err
+		}
+
+		w, err := zw.Create(folder + reportCardFilename(exam, r))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResultsSheetPDF downloads the ranked results of a whole exam
+func ResultsSheetPDF(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exam, results, err := loadExamResults(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	pdf := newPDF("Results Sheet")
+	pdfField(pdf, "Exam", exam.Name)
+	pdfField(pdf, "Date", exam.Date.Format("02 January 2006"))
+	if batch := batchName(ctx, exam.BatchID); batch != "" {
+		pdfField(pdf, "Batch", batch)
+	}
+	if exam.Subject != "" {
+		pdfField(pdf, "Subject", exam.Subject)
+	}
+	pdfField(pdf, "Full Marks", fmt.Sprintf("%g", exam.FullMarks))
+	pdf.Ln(4)
+
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		pct := examPercentage(exam, r)
+		rows = append(rows, []string{
+			fmt.Sprint(r.Rank), r.Name, r.PhoneNumber, r.CQ, r.MCQ,
+			fmt.Sprint(r.Total), fmt.Sprintf("%.1f", pct), gradeFor(pct, r.Absent),
+		})
+	}
+	pdfTable(pdf,
+		[]string{"Rank", "Name", "Phone", "CQ", "MCQ", "Total", "%", "Grade"},
+		[]float64{13, 52, 30, 17, 17, 17, 17, 17},
+		rows)
+
+	return sendPDF(c, pdf, fmt.Sprintf("results_%s.pdf", safeFilename(exam.Name)))
+}
+
+// writeReportCard renders one result on the current page
+func writeReportCard(ctx context.Context, pdf *fpdf.Fpdf, exam models.Exam, r models.Result) {
+	var student models.Student
+	if objID, err := primitive.ObjectIDFromHex(r.StudentID); err == nil {
+		database.DB.Collection("students").FindOne(ctx, bson.M{"_id": objID}).Decode(&student)
+	}
+
+	pct := examPercentage(exam, r)
+	grade := gradeFor(pct, r.Absent)
+
+	pdfField(pdf, "Student", r.Name)
+	if student.Class != "" {
+		pdfField(pdf, "Class", student.Class)
+	}
+	if batch := batchName(ctx, exam.BatchID); batch != "" {
+		pdfField(pdf, "Batch", batch)
+	} else if student.BatchTime != "" {
+		pdfField(pdf, "Batch", student.BatchTime)
+	}
+	pdfField(pdf, "Phone", r.PhoneNumber)
+	pdf.Ln(3)
+	pdfField(pdf, "Exam", exam.Name)
+	pdfField(pdf, "Date", exam.Date.Format("02 January 2006"))
+	if exam.Subject != "" {
+		pdfField(pdf, "Subject", exam.Subject)
+	}
+	pdf.Ln(4)
+
+	pdfTable(pdf,
+		[]string{"Component", "Marks"},
+		[]float64{90, 90},
+		[][]string{
+			{"CQ", r.CQ},
+			{"MCQ", r.MCQ},
+			{"Total", fmt.Sprintf("%d / %g", r.Total, exam.FullMarks)},
+			{"Percentage", fmt.Sprintf("%.2f%%", pct)},
+			{"Grade", grade},
+			{"Rank", fmt.Sprintf("%d of %d", r.Rank, exam.Participants)},
+		})
+	pdf.Ln(6)
+
+	remarks := r.Remarks
+	if remarks == "" {
+		remarks = remarksFor(grade)
+	}
+	pdfField(pdf, "Remarks", remarks)
+
+	pdf.Ln(25)
+	pdf.SetFont("Helvetica", "", 10)
+	pdf.CellFormat(60, 6, "Teacher's signature", "T", 0, "C", false, 0, "")
+	pdf.CellFormat(60, 6, "", "", 0, "C", false, 0, "")
+	pdf.CellFormat(60, 6, "Guardian's signature", "T", 1, "C", false, 0, "")
+}
+
+// loadExamResults fetches an exam and its results ordered by rank
+func loadExamResults(ctx context.Context, id string) (models.Exam, []models.Result, error) {
+	var exam models.Exam
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return exam, nil, fmt.Errorf("Exam not found")
+	}
+
+	if err := database.DB.Collection("exams").FindOne(ctx, bson.M{"_id": objID}).Decode(&exam); err != nil {
+		return exam, nil, fmt.Errorf("Exam not found")
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "rank", Value: 1}, {Key: "name", Value: 1}})
+	cursor, err := database.DB.Collection("results").Find(ctx, bson.M{"exam_id": objID}, opts)
+	if err != nil {
+		return exam, nil, fmt.Errorf("Cannot fetch results")
+	}
+
+	var results []models.Result
+	if err := cursor.All(ctx, &results); err != nil {
+		return exam, nil, fmt.Errorf("Cannot parse results")
+	}
+
+	return exam, results, nil
+}
+
+// batchName looks up a batch's display name, empty if unknown
+func batchName(ctx context.Context, id string) string {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ""
+	}
+
+	var batch models.Batch
+	if err := database.DB.Collection("batches").FindOne(ctx, bson.M{"_id": objID}).Decode(&batch); err != nil {
+		return ""
+	}
+	return batch.BatchName
+}
+
+func examPercentage(exam models.Exam, r models.Result) float64 {
+	if exam.FullMarks <= 0 {
+		return float64(r.Total)
+	}
+	return round2(float64(r.Total) / exam.FullMarks * 100)
+}
+
+// Letter grade on the usual SSC/HSC scale
+func gradeFor(pct float64, absent bool) string {
+	switch {
+	case absent:
+		return "Absent"
+	case pct >= 80:
+		return "A+"
+	case pct >= 70:
+		return "A"
+	case pct >= 60:
+		return "A-"
+	case pct >= 50:
+		return "B"
+	case pct >= 40:
+		return "C"
+	case pct >= 33:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+// Default remark when the teacher didn't write one
+func remarksFor(grade string) string {
+	switch grade {
+	case "A+":
+		return "Excellent. Keep it up."
+	case "A", "A-":
+		return "Very good."
+	case "B", "C":
+		return "Good, but there is room to improve."
+	case "D":
+		return "Needs more practice."
+	case "Absent":
+		return "Was absent in this exam."
+	default:
+		return "Needs serious attention. Please meet the teacher."
+	}
+}
+
+// reportCardFilename names a report card by rank, name and exam; the
+// student ID keeps two students of the same name and rank apart
+func reportCardFilename(exam models.Exam, r models.Result) string {
+	return fmt.Sprintf("%03d_%s_%s_%s.pdf", r.Rank, safeFilename(r.Name), r.StudentID, safeFilename(exam.Name))
+}
+
+// safeFilename keeps letters and digits and turns the rest into underscores
+func safeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
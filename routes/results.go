@@ -1,17 +1,24 @@
 package routes
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
 	"github.com/gofiber/fiber/v2"
 	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // StudentResult represents the incoming data from frontend
 type StudentResult struct {
+	StudentID   string `json:"student_id"`
 	Name        string `json:"name"`
 	PhoneNumber string `json:"phone_number"`
 	Class       string `json:"class"`
@@ -19,6 +26,7 @@ type StudentResult struct {
 	StudyDays   string `json:"study_days"`
 	CQ          string `json:"cq"`
 	MCQ         string `json:"mcq"`
+	Remarks     string `json:"remarks"`
 }
 
 // Handler function to receive results and stream Excel file
@@ -28,9 +36,17 @@ func SubmitResults(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	// Call notifyMarks for each student
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch study days"})
+	}
+
+	// Text each student their marks
 	for _, s := range results {
-		notifyMarks(s)
+		notifyMarks(s, c.Query("exam"), patterns)
 	}
 
 	// Sort by total marks descending
@@ -40,6 +56,23 @@ func SubmitResults(c *fiber.Ctx) error {
 		return totalI > totalJ
 	})
 
+	// Keep the results when the frontend names the exam, so they show up
+	// in each student's progress history
+	if name := c.Query("exam"); name != "" {
+		exam, err := examFromQuery(c, name)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := checkSubmitter(ctx, exam); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if _, err := saveExamResults(ctx, exam, results); err != nil {
+			log.Println("❌ Failed to save exam results:", err)
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to save results"})
+		}
+	}
+
 	// Create Excel file
 	f := excelize.NewFile()
 	sheet := "Sheet1"
@@ -61,7 +94,7 @@ func SubmitResults(c *fiber.Ctx) error {
 		f.SetCellValue(sheet, fmt.Sprintf("B%d", row), s.PhoneNumber)
 		f.SetCellValue(sheet, fmt.Sprintf("C%d", row), s.Class)
 		f.SetCellValue(sheet, fmt.Sprintf("D%d", row), s.BatchTime)
-		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), formatStudyDays(s.StudyDays))
+		f.SetCellValue(sheet, fmt.Sprintf("E%d", row), patterns.Label(s.StudyDays))
 		f.SetCellValue(sheet, fmt.Sprintf("F%d", row), s.CQ)
 		f.SetCellValue(sheet, fmt.Sprintf("G%d", row), s.MCQ)
 		f.SetCellValue(sheet, fmt.Sprintf("H%d", row), cq+mcq)
@@ -74,10 +107,19 @@ func SubmitResults(c *fiber.Ctx) error {
 	return c.SendStream(buf)
 }
 
-// notify function
-func notifyMarks(r StudentResult) {
-	fmt.Printf("📢 Student: %s (%s) | CQ: %s | MCQ: %s | Days: %s\n",
-		r.Name, r.PhoneNumber, r.CQ, r.MCQ, formatStudyDays(r.StudyDays))
+// notifyMarks texts a student their marks in an exam (which may be unnamed)
+func notifyMarks(r StudentResult, exam string, patterns studyDays) {
+	message := "Marks for student: " + r.Name
+	if exam != "" {
+		message += "\n | Exam: " + exam
+	}
+	message += "\n | CQ: " + r.CQ +
+		"\n | MCQ: " + r.MCQ +
+		"\n | Class: " + r.Class +
+		"\n | Batch: " + r.BatchTime +
+		"\n | Days: " + patterns.Label(r.StudyDays)
+
+	sendSMS(r.PhoneNumber, message)
 }
 
 // Parse marks (handles "Absent")
@@ -89,15 +131,123 @@ func parseMarks(val string) int {
 	return i
 }
 
-// Convert smw / stt to full names
-func formatStudyDays(code string) string {
-	switch strings.ToLower(code) {
-	case "smw":
-		return "Saturday, Monday, Wednesday"
-	case "stt":
-		return "Sunday, Tuesday, Thursday"
-	default:
-		return code
+// Build an exam from the ?exam=&date=&full_marks=&batch_id=&teacher_id= query params
+func examFromQuery(c *fiber.Ctx, name string) (*models.Exam, error) {
+	exam := &models.Exam{
+		Name:        name,
+		Date:        time.Now(),
+		Class:       c.Query("class"),
+		Subject:     c.Query("subject"),
+		BatchID:     c.Query("batch_id"),
+		FullMarks:   100,
+		SubmittedBy: c.Query("teacher_id"),
+	}
+
+	if d := c.Query("date"); d != "" {
+		date, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			return nil, fmt.Errorf("date must be YYYY-MM-DD")
+		}
+		exam.Date = date
+	}
+
+	if fm := c.Query("full_marks"); fm != "" {
+		f, err := strconv.ParseFloat(fm, 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("full_marks must be a positive number")
+		}
+		exam.FullMarks = f
+	}
+
+	return exam, nil
+}
+
+// checkSubmitter makes sure the teacher submitting the results exists
+func checkSubmitter(ctx context.Context, exam *models.Exam) error {
+	if exam.SubmittedBy == "" {
+		return nil
 	}
+	staff, err := findStaff(ctx, exam.SubmittedBy)
+	if err != nil {
+		return fmt.Errorf("teacher not found")
+	}
+	if staff.Role != models.StaffTeacher {
+		return fmt.Errorf("%s is not a teacher", staff.Name)
+	}
+	return nil
 }
 
+// saveExamResults stores the exam and one result per student with their rank.
+// Students are matched by student_id, or by phone number when it is unique
+// (or names tell siblings apart). Absentees are not counted as participants.
+func saveExamResults(ctx context.Context, exam *models.Exam, results []StudentResult) ([]models.Result, error) {
+	examCollection := database.DB.Collection("exams")
+	resultCollection := database.DB.Collection("results")
+
+	exam.ID = primitive.NewObjectID()
+	exam.Participants = 0
+	for _, r := range results {
+		if !(r.CQ == "Absent" && r.MCQ == "Absent") {
+			exam.Participants++ // absentees sat no paper
+		}
+	}
+	exam.CreatedAt = time.Now()
+
+	if _, err := examCollection.InsertOne(ctx, exam); err != nil {
+		return nil, err
+	}
+
+	saved := make([]models.Result, 0, len(results))
+	for _, r := range results {
+		saved = append(saved, models.Result{
+			ID:          primitive.NewObjectID(),
+			ExamID:      exam.ID,
+			StudentID:   r.StudentID,
+			Name:        r.Name,
+			PhoneNumber: r.PhoneNumber,
+			CQ:          r.CQ,
+			MCQ:         r.MCQ,
+			Total:       parseMarks(r.CQ) + parseMarks(r.MCQ),
+			Absent:      r.CQ == "Absent" && r.MCQ == "Absent",
+			Remarks:     r.Remarks,
+		})
+	}
+
+	// Standard competition ranking: equal totals share a rank (1, 2, 2, 4)
+	sort.SliceStable(saved, func(i, j int) bool { return saved[i].Total > saved[j].Total })
+	for i := range saved {
+		if i > 0 && saved[i].Total == saved[i-1].Total {
+			saved[i].Rank = saved[i-1].Rank
+		} else {
+			saved[i].Rank = i + 1
+		}
+	}
+
+	// Rows without a student ID are matched by phone number, whichever way
+	// it was written, and by name where siblings share one
+	var matcher *studentMatcher
+	docs := make([]interface{}, 0, len(saved))
+	for i := range saved {
+		if saved[i].StudentID == "" && saved[i].PhoneNumber != "" {
+			if matcher == nil {
+				m, err := newStudentMatcher(ctx, exam.BatchID)
+				if err != nil {
+					return nil, err
+				}
+				matcher = m
+			}
+			if s, _ := matcher.match("", saved[i].PhoneNumber, strings.TrimSpace(saved[i].Name)); s != nil {
+				saved[i].StudentID = s.ID.Hex()
+			}
+		}
+		docs = append(docs, saved[i])
+	}
+
+	if len(docs) > 0 {
+		if _, err := resultCollection.InsertMany(ctx, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	return saved, nil
+}
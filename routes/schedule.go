@@ -0,0 +1,372 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The centre's week starts on Saturday
+var weekOrder = []time.Weekday{
+	time.Saturday, time.Sunday, time.Monday, time.Tuesday,
+	time.Wednesday, time.Thursday, time.Friday,
+}
+
+// ScheduleConflict is another batch that needs the same room or teacher
+// at the same time
+type ScheduleConflict struct {
+	BatchID   string `json:"batch_id"`
+	BatchName string `json:"batch_name"`
+	Day       string `json:"day"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Reason    string `json:"reason"`
+}
+
+// TimetableSlot is one batch's class on a weekday
+type TimetableSlot struct {
+	BatchID    string   `json:"batch_id"`
+	BatchName  string   `json:"batch_name"`
+	Class      string   `json:"class"`
+	Subject    string   `json:"subject"`
+	Start      string   `json:"start"`
+	End        string   `json:"end"`
+	Room       string   `json:"room,omitempty"`
+	Teacher    string   `json:"teacher,omitempty"`
+	TeacherIDs []string `json:"teacher_ids,omitempty"`
+	// only set for a dated week (?week_of=)
+	Cancelled bool   `json:"cancelled,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	MakeUp    bool   `json:"make_up,omitempty"`
+}
+
+// TimetableDay is one column of the weekly grid
+type TimetableDay struct {
+	Day   string          `json:"day"`
+	Date  string          `json:"date,omitempty"`
+	Slots []TimetableSlot `json:"slots"`
+}
+
+// UpdateBatchSchedule sets the schedule of an existing batch
+func UpdateBatchSchedule(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var schedule models.Schedule
+	if err := c.BodyParser(&schedule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batchCollection := database.DB.Collection("batches")
+
+	var batch models.Batch
+	if err := batchCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&batch); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Batch not found"})
+	}
+
+	batch.Schedule = &schedule
+	if status, body := checkBatchSchedule(ctx, &batch); status != 0 {
+		return c.Status(status).JSON(body)
+	}
+
+	_, err = batchCollection.UpdateByID(ctx, objID, bson.M{"$set": bson.M{
+		"schedule": batch.Schedule,
+		"days":     batch.Days,
+		"time":     batch.Time,
+	}})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update batch"})
+	}
+
+	return c.JSON(batch)
+}
+
+// GetTimetable returns the weekly grid of every batch with a known time.
+// With ?week_of=YYYY-MM-DD it is the actual week (Saturday to Friday)
+// containing that date, with holidays cancelled and make-up classes added.
+func GetTimetable(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch batches"})
+	}
+
+	dates := make(map[time.Weekday]string)
+	var off holidays
+	if weekOf := c.Query("week_of"); weekOf != "" {
+		day, err := time.Parse(dateLayout, weekOf)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "week_of must be YYYY-MM-DD"})
+		}
+		saturday := day.AddDate(0, 0, -int((day.Weekday()+1)%7))
+		for i, wd := range weekOrder {
+			dates[wd] = saturday.AddDate(0, 0, i).Format(dateLayout)
+		}
+
+		off, err = loadHolidays(ctx, dates[time.Saturday], dates[time.Friday])
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch holidays"})
+		}
+	}
+
+	grid := make(map[time.Weekday][]TimetableSlot)
+	var unscheduled []string
+	for _, b := range batches {
+		s := batchSchedule(b)
+		if s == nil {
+			unscheduled = append(unscheduled, b.BatchName)
+			continue
+		}
+		slot := TimetableSlot{
+			BatchID:    b.ID.Hex(),
+			BatchName:  b.BatchName,
+			Class:      b.Class,
+			Subject:    b.Subject,
+			Start:      s.Start,
+			End:        s.End,
+			Room:       s.Room,
+			Teacher:    s.Teacher,
+			TeacherIDs: b.TeacherIDs,
+		}
+		for _, wd := range weekOrder {
+			daySlot := slot
+			if !containsWeekday(batchWeekdays(b), wd) {
+				if len(dates) == 0 || !off.MakeUp(slot.BatchID, dates[wd]) {
+					continue
+				}
+				daySlot.MakeUp = true
+			}
+			if h := off.Off(slot.BatchID, dates[wd]); len(dates) > 0 && h != nil {
+				daySlot.Cancelled = true
+				daySlot.Reason = h.Reason
+			}
+			grid[wd] = append(grid[wd], daySlot)
+		}
+	}
+
+	days := make([]TimetableDay, 0, len(weekOrder))
+	for _, wd := range weekOrder {
+		slots := grid[wd]
+		sort.Slice(slots, func(i, j int) bool { return slots[i].Start < slots[j].Start })
+		if slots == nil {
+			slots = []TimetableSlot{}
+		}
+		days = append(days, TimetableDay{Day: wd.String(), Date: dates[wd], Slots: slots})
+	}
+
+	return c.JSON(fiber.Map{"days": days, "unscheduled": unscheduled})
+}
+
+// checkBatchSchedule validates the batch's schedule (or its loose Days) and
+// looks for clashes with other batches. It returns a non-zero status and a
+// response body when the batch can't be saved.
+func checkBatchSchedule(ctx context.Context, batch *models.Batch) (int, fiber.Map) {
+	if batch.Schedule == nil {
+		for _, d := range batch.Days {
+			if _, ok := parseWeekday(d); !ok {
+				return fiber.StatusBadRequest, fiber.Map{"error": fmt.Sprintf("unknown day %q", d)}
+			}
+		}
+		return 0, nil
+	}
+
+	if err := normalizeSchedule(batch.Schedule); err != nil {
+		return fiber.StatusBadRequest, fiber.Map{"error": err.Error()}
+	}
+	batch.Days = batch.Schedule.Weekdays
+	batch.Time = formatClock(batch.Schedule.Start) + " - " + formatClock(batch.Schedule.End)
+
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return fiber.StatusInternalServerError, fiber.Map{"error": "Cannot fetch batches"}
+	}
+
+	if conflicts := scheduleConflicts(*batch, batches); len(conflicts) > 0 {
+		return fiber.StatusConflict, fiber.Map{"error": "Schedule clashes with other batches", "conflicts": conflicts}
+	}
+	return 0, nil
+}
+
+// normalizeSchedule checks a schedule and rewrites it in canonical form:
+// full day names in week order and 24h times
+func normalizeSchedule(s *models.Schedule) error {
+	if len(s.Weekdays) == 0 {
+		return fmt.Errorf("schedule needs at least one weekday")
+	}
+
+	seen := make(map[time.Weekday]bool)
+	for _, d := range s.Weekdays {
+		wd, ok := parseWeekday(d)
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", d)
+		}
+		seen[wd] = true
+	}
+	s.Weekdays = s.Weekdays[:0]
+	for _, wd := range weekOrder {
+		if seen[wd] {
+			s.Weekdays = append(s.Weekdays, wd.String())
+		}
+	}
+
+	start, err := parseClock(s.Start)
+	if err != nil {
+		return fmt.Errorf("invalid start time %q", s.Start)
+	}
+	end, err := parseClock(s.End)
+	if err != nil {
+		return fmt.Errorf("invalid end time %q", s.End)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end time must be after start time")
+	}
+
+	s.Start = start.Format("15:04")
+	s.End = end.Format("15:04")
+	s.Room = strings.TrimSpace(s.Room)
+	s.Teacher = strings.TrimSpace(s.Teacher)
+	return nil
+}
+
+// scheduleConflicts lists the batches sharing a room or teacher with b at
+// an overlapping time on the same weekday
+func scheduleConflicts(b models.Batch, others []models.Batch) []ScheduleConflict {
+	conflicts := []ScheduleConflict{}
+	if b.Schedule == nil {
+		return conflicts
+	}
+
+	for _, o := range others {
+		if o.ID == b.ID || o.Schedule == nil {
+			continue
+		}
+
+		var reasons []string
+		if b.Schedule.Room != "" && strings.EqualFold(b.Schedule.Room, o.Schedule.Room) {
+			reasons = append(reasons, "room "+o.Schedule.Room)
+		}
+		if b.Schedule.Teacher != "" && strings.EqualFold(b.Schedule.Teacher, o.Schedule.Teacher) {
+			reasons = append(reasons, "teacher "+o.Schedule.Teacher)
+		}
+		for _, id := range b.TeacherIDs {
+			for _, oid := range o.TeacherIDs {
+				if id == oid {
+					reasons = append(reasons, "teacher "+id)
+				}
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+
+		// Times are "15:04" so string comparison orders them
+		if b.Schedule.Start >= o.Schedule.End || o.Schedule.Start >= b.Schedule.End {
+			continue
+		}
+
+		for _, d := range b.Schedule.Weekdays {
+			for _, od := range o.Schedule.Weekdays {
+				if d == od {
+					conflicts = append(conflicts, ScheduleConflict{
+						BatchID:   o.ID.Hex(),
+						BatchName: o.BatchName,
+						Day:       d,
+						Start:     o.Schedule.Start,
+						End:       o.Schedule.End,
+						Reason:    "same " + strings.Join(reasons, " and "),
+					})
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// batchSchedule returns the batch's schedule, or one worked out from the
+// free-form Days and Time of older batches ("4:00 PM - 5:30 PM").
+// It returns nil when the time can't be read.
+func batchSchedule(b models.Batch) *models.Schedule {
+	if b.Schedule != nil {
+		return b.Schedule
+	}
+
+	parts := strings.Split(b.Time, "-")
+	if len(parts) != 2 || len(b.Days) == 0 {
+		return nil
+	}
+
+	s := &models.Schedule{
+		Weekdays: append([]string(nil), b.Days...),
+		Start:    strings.TrimSpace(parts[0]),
+		End:      strings.TrimSpace(parts[1]),
+	}
+	if normalizeSchedule(s) != nil {
+		return nil
+	}
+	return s
+}
+
+// batchWeekdays are the days the batch meets; nil means unknown
+func batchWeekdays(b models.Batch) []time.Weekday {
+	days := b.Days
+	if b.Schedule != nil {
+		days = b.Schedule.Weekdays
+	}
+
+	var weekdays []time.Weekday
+	for _, d := range days {
+		if wd, ok := parseWeekday(d); ok {
+			weekdays = append(weekdays, wd)
+		}
+	}
+	return weekdays
+}
+
+// parseClock reads "16:00", "4:00 PM", "4:00PM" or "4 PM"
+func parseClock(s string) (time.Time, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, layout := range []string{"15:04", "3:04 PM", "3:04PM", "3 PM", "3PM"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time")
+}
+
+// formatClock turns "16:00" into "4:00 PM"
+func formatClock(s string) string {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return s
+	}
+	return t.Format("3:04 PM")
+}
+
+func allBatches(ctx context.Context) ([]models.Batch, error) {
+	cursor, err := database.DB.Collection("batches").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []models.Batch
+	if err := cursor.All(ctx, &batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
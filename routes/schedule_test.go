@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/dishan1223/cms/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestScheduleConflicts(t *testing.T) {
+	batch := func(name string, s models.Schedule, teachers ...string) models.Batch {
+		return models.Batch{ID: primitive.NewObjectID(), BatchName: name, Schedule: &s, TeacherIDs: teachers}
+	}
+	b := batch("Physics A", models.Schedule{Weekdays: []string{"Saturday", "Monday"}, Start: "16:00", End: "17:30", Room: "Room 1", Teacher: "Rahim"}, "t1")
+
+	tests := []struct {
+		name   string
+		other  models.Batch
+		want   int
+		reason string
+	}{
+		{"same room overlapping", batch("Maths", models.Schedule{Weekdays: []string{"Saturday"}, Start: "17:00", End: "18:00", Room: "Room 1"}), 1, "same room Room 1"},
+		{"room matched case-insensitively", batch("Maths", models.Schedule{Weekdays: []string{"Saturday"}, Start: "16:30", End: "17:00", Room: "room 1"}), 1, "same room room 1"},
+		{"teacher matched case-insensitively", batch("Chemistry", models.Schedule{Weekdays: []string{"Monday"}, Start: "15:00", End: "16:30", Teacher: "RAHIM"}), 1, "same teacher RAHIM"},
+		{"same staff teacher", batch("Biology", models.Schedule{Weekdays: []string{"Monday"}, Start: "16:00", End: "17:30"}, "t1"), 1, "same teacher t1"},
+		{"room and teacher on both days", batch("Maths", models.Schedule{Weekdays: []string{"Saturday", "Monday"}, Start: "15:00", End: "19:00", Room: "Room 1", Teacher: "rahim"}), 2, "same room Room 1 and teacher rahim"},
+		{"ends as the other starts", batch("Maths", models.Schedule{Weekdays: []string{"Saturday"}, Start: "14:30", End: "16:00", Room: "Room 1"}), 0, ""},
+		{"starts as the other ends", batch("Maths", models.Schedule{Weekdays: []string{"Saturday"}, Start: "17:30", End: "19:00", Room: "Room 1"}), 0, ""},
+		{"overlapping on another day", batch("Maths", models.Schedule{Weekdays: []string{"Sunday"}, Start: "16:00", End: "17:30", Room: "Room 1"}), 0, ""},
+		{"overlapping in another room", batch("Maths", models.Schedule{Weekdays: []string{"Saturday"}, Start: "16:00", End: "17:30", Room: "Room 2", Teacher: "Karim"}), 0, ""},
+		{"unscheduled", models.Batch{ID: primitive.NewObjectID(), BatchName: "Maths"}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scheduleConflicts(b, []models.Batch{b, tt.other})
+			if len(got) != tt.want {
+				t.Fatalf("scheduleConflicts() = %v, want %d conflicts", got, tt.want)
+			}
+			for _, c := range got {
+				if c.Reason != tt.reason || c.BatchID != tt.other.ID.Hex() {
+					t.Errorf("conflict = %+v, want reason %q with %s", c, tt.reason, tt.other.BatchName)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetStaff lists staff, optionally filtered by ?role= and ?status=
+func GetStaff(c *fiber.Ctx) error {
+	filter := bson.M{}
+	if role := c.Query("role"); role != "" {
+		filter["role"] = role
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := database.DB.Collection("staff").Find(ctx, filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch staff"})
+	}
+
+	staff := []models.Staff{}
+	if err := cursor.All(ctx, &staff); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse staff"})
+	}
+	return c.JSON(staff)
+}
+
+// GetStaffByID returns one staff member
+func GetStaffByID(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	staff, err := findStaff(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Staff not found"})
+	}
+	return c.JSON(staff)
+}
+
+// AddStaff creates a staff record
+func AddStaff(c *fiber.Ctx) error {
+	var staff models.Staff
+	if err := c.BodyParser(&staff); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if err := normalizeStaff(&staff); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	staff.ID = primitive.NewObjectID()
+	staff.CreatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := database.DB.Collection("staff").InsertOne(ctx, staff); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert staff"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(staff)
+}
+
+// UpdateStaff replaces a staff member's details
+func UpdateStaff(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	existing, err := findStaff(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Staff not found"})
+	}
+
+	// Start from the stored record so missing fields stay as they are
+	staff := *existing
+	if err := c.BodyParser(&staff); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	staff.ID = existing.ID
+	staff.CreatedAt = existing.CreatedAt
+	if err := normalizeStaff(&staff); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if _, err := database.DB.Collection("staff").ReplaceOne(ctx, bson.M{"_id": staff.ID}, staff); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update staff"})
+	}
+	return c.JSON(staff)
+}
+
+// DeleteStaff removes a staff member who teaches no batch; otherwise set
+// their status to inactive instead
+func DeleteStaff(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assigned, err := database.DB.Collection("batches").CountDocuments(ctx, bson.M{"teacher_ids": objID.Hex()})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check batches"})
+	}
+	if assigned > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("Still assigned to %d batches; set status to inactive instead", assigned)})
+	}
+
+	res, err := database.DB.Collection("staff").DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete staff"})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Staff not found"})
+	}
+	return c.JSON(fiber.Map{"success": true, "message": "Staff deleted successfully"})
+}
+
+// AssignTeachers sets the teachers of a batch: {"teacher_ids": [...]}
+func AssignTeachers(c *fiber.Ctx) error {
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req struct {
+		TeacherIDs []string `json:"teacher_ids"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, id := range req.TeacherIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		staff, err := findStaff(ctx, id)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Staff not found: " + id})
+		}
+		if staff.Role != models.StaffTeacher || staff.Status != models.StaffActive {
+			return c.Status(400).JSON(fiber.Map{"error": staff.Name + " is not an active teacher"})
+		}
+		ids = append(ids, id)
+	}
+
+	batchCollection := database.DB.Collection("batches")
+	var batch models.Batch
+	if err := batchCollection.FindOne(ctx, bson.M{"_id": objID}).Decode(&batch); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Batch not found"})
+	}
+	batch.TeacherIDs = ids
+
+	// A teacher can't be in two classes at once
+	if batch.Schedule != nil {
+		batches, err := allBatches(ctx)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch batches"})
+		}
+		if conflicts := scheduleConflicts(batch, batches); len(conflicts) > 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Schedule clashes with other batches", "conflicts": conflicts})
+		}
+	}
+
+	if _, err := batchCollection.UpdateByID(ctx, objID, bson.M{"$set": bson.M{"teacher_ids": ids}}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update batch"})
+	}
+	return c.JSON(batch)
+}
+
+// GetTeacherBatches lists the batches a teacher is assigned to
+func GetTeacherBatches(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batches, err := teacherBatches(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch batches"})
+	}
+	return c.JSON(batches)
+}
+
+// GetTeacherStudents lists the students of all of a teacher's batches
+func GetTeacherStudents(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batches, err := teacherBatches(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch batches"})
+	}
+
+	batchIDs := make([]string, 0, len(batches))
+	for _, b := range batches {
+		batchIDs = append(batchIDs, b.ID.Hex())
+	}
+
+	// One entry per enrolment, so a student in two of the teacher's
+	// batches is listed under each
+	sort.Strings(batchIDs)
+	students := []models.Student{}
+	today := time.Now().Format(dateLayout)
+	for _, batchID := range batchIDs {
+		enrolled, err := enrolledStudents(ctx, batchID, today)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+		}
+		for _, s := range enrolled {
+			s.BatchID = batchID
+			students = append(students, s)
+		}
+	}
+
+	return c.JSON(students)
+}
+
+func teacherBatches(ctx context.Context, staffID string) ([]models.Batch, error) {
+	cursor, err := database.DB.Collection("batches").Find(ctx, bson.M{"teacher_ids": staffID})
+	if err != nil {
+		return nil, err
+	}
+	batches := []models.Batch{}
+	if err := cursor.All(ctx, &batches); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+func findStaff(ctx context.Context, id string) (*models.Staff, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var staff models.Staff
+	if err := database.DB.Collection("staff").FindOne(ctx, bson.M{"_id": objID}).Decode(&staff); err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+// normalizeStaff validates a staff record and fills in defaults
+func normalizeStaff(s *models.Staff) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(normalizePhone(s.Phone)) != 11 {
+		return fmt.Errorf("phone number must have 11 digits")
+	}
+
+	if s.Role == "" {
+		s.Role = models.StaffTeacher
+	}
+	switch s.Role {
+	case models.StaffTeacher, models.StaffAdmin, models.StaffFrontDesk:
+	default:
+		return fmt.Errorf("role must be teacher, admin or front_desk")
+	}
+
+	if s.Status == "" {
+		s.Status = models.StaffActive
+	}
+	if s.Status != models.StaffActive && s.Status != models.StaffInactive {
+		return fmt.Errorf("status must be active or inactive")
+	}
+
+	if s.JoiningDate != "" {
+		if _, err := time.Parse(dateLayout, s.JoiningDate); err != nil {
+			return fmt.Errorf("joining_date must be YYYY-MM-DD")
+		}
+	}
+	if s.Subjects == nil {
+		s.Subjects = []string{}
+	}
+	return nil
+}
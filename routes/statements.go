@@ -0,0 +1,520 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/auth"
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Statement header names recognised without an explicit mapping
+var statementHeaderAliases = map[string][]string{
+	"transaction_id": {"Transaction ID", "TrxID", "Trx ID", "TxnID", "Reference", "Ref No"},
+	"amount":         {"Amount", "Transaction Amount", "Credit", "Received"},
+	"sender_number":  {"Sender", "Sender Number", "From", "From Wallet", "Customer", "Customer Account", "Account No"},
+	"time":           {"Date", "Time", "Date Time", "Transaction Date", "Transaction Time"},
+}
+
+// Ways statements write their dates, tried in order
+var statementTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006 03:04 PM",
+	"02/01/2006",
+	"02-01-2006 15:04:05",
+	"02-01-2006",
+	"02-Jan-2006 15:04:05",
+	"02-Jan-2006 03:04 PM",
+	"02-Jan-2006",
+	"02 Jan 2006 15:04",
+	"02 Jan 2006",
+	"Jan 02, 2006 03:04 PM",
+}
+
+// Reconciliation states of a statement line
+const (
+	lineMatched   = "matched"   // same transaction ID, amount and sender
+	lineMismatch  = "mismatch"  // paired with a payment but something differs
+	lineUnmatched = "unmatched" // nothing in the ledger
+)
+
+// ReconciledLine is a statement line with the payment it was paired with
+type ReconciledLine struct {
+	models.StatementLine
+	Status    string   `json:"status"`
+	PaymentID string   `json:"payment_id,omitempty"`
+	ReceiptNo string   `json:"receipt_no,omitempty"`
+	Problems  []string `json:"problems,omitempty"`
+}
+
+// Reconciliation compares a statement with the payments ledger
+type Reconciliation struct {
+	Statement         models.Statement `json:"statement"`
+	Lines             []ReconciledLine `json:"lines"`
+	Matched           int              `json:"matched"`
+	Mismatched        int              `json:"mismatched"`
+	UnmatchedLines    []ReconciledLine `json:"unmatched_lines"`
+	UnmatchedPayments []models.Payment `json:"unmatched_payments"` // on the ledger but not the statement
+	StatementTotal    float64          `json:"statement_total"`
+	LedgerTotal       float64          `json:"ledger_total"`
+}
+
+// UploadStatement reads a merchant statement CSV (or .xlsx) and reconciles
+// it against the payments ledger.
+//
+// Form fields: file, method (bkash, nagad or bank) and an optional mapping
+// (JSON object of header -> field, where field is one of transaction_id,
+// amount, sender_number, time) for statements whose headers aren't known.
+// Rows with no positive amount, such as cash outs and charges, are skipped.
+func UploadStatement(c *fiber.Ctx) error {
+	method := strings.ToLower(strings.TrimSpace(c.FormValue("method")))
+	if method != models.MethodBkash && method != models.MethodNagad && method != models.MethodBank {
+		return c.Status(400).JSON(fiber.Map{"error": "method must be bkash, nagad or bank"})
+	}
+
+	mapping := map[string]string{}
+	if m := c.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "mapping must be a JSON object"})
+		}
+		for h, field := range mapping {
+			if _, ok := statementHeaderAliases[field]; !ok {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown field %q for column %q", field, h)})
+			}
+		}
+	}
+
+	sheets, err := readUploadedSheets(c, "file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(sheets) == 0 || len(sheets[0].Rows) < 2 {
+		return c.Status(400).JSON(fiber.Map{"error": "file has no data rows"})
+	}
+
+	rows := sheets[0].Rows
+	index := headerIndex(rows[0], mapping, statementHeaderAliases)
+	for _, field := range []string{"transaction_id", "amount", "time"} {
+		if _, ok := index[field]; !ok {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("no %s column found", field), "header": rows[0]})
+		}
+	}
+
+	statement := models.Statement{
+		ID:         primitive.NewObjectID(),
+		Method:     method,
+		Lines:      []models.StatementLine{},
+		UploadedBy: auth.CurrentUser(c),
+		UploadedAt: time.Now(),
+	}
+	if fh, err := c.FormFile("file"); err == nil {
+		statement.Filename = fh.Filename
+	}
+
+	var first, last time.Time
+	var problems []string
+	seen := map[string]int{}
+	for i, row := range rows[1:] {
+		if blankRow(row) {
+			continue
+		}
+		n := i + 2
+
+		amount, err := parseStatementAmount(cell(row, index, "amount"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", n, err))
+			continue
+		}
+		if amount <= 0 {
+			continue
+		}
+		trxID := strings.ToUpper(cell(row, index, "transaction_id"))
+		if trxID == "" {
+			problems = append(problems, fmt.Sprintf("row %d: no transaction ID", n))
+			continue
+		}
+		if prev, dup := seen[trxID]; dup {
+			problems = append(problems, fmt.Sprintf("row %d: same transaction ID as row %d", n, prev))
+			continue
+		}
+		t, err := parseStatementTime(cell(row, index, "time"))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", n, err))
+			continue
+		}
+		seen[trxID] = n
+
+		statement.Lines = append(statement.Lines, models.StatementLine{
+			Row:           n,
+			TransactionID: trxID,
+			Amount:        round2(amount),
+			SenderNumber:  normalizePhone(cell(row, index, "sender_number")),
+			Time:          t,
+		})
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	if len(problems) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Some rows could not be read", "problems": problems})
+	}
+	if len(statement.Lines) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "statement has no money received"})
+	}
+	statement.From = first.Format(dateLayout)
+	statement.To = last.Format(dateLayout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if _, err := database.DB.Collection("statements").InsertOne(ctx, statement); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot save statement"})
+	}
+
+	report, err := reconcileStatement(ctx, statement)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reconcile statement"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(report)
+}
+
+// GetStatements lists uploaded statements, newest first, without their lines
+func GetStatements(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.M{"uploaded_at": -1}).SetProjection(bson.M{"lines": 0})
+	cursor, err := database.DB.Collection("statements").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch statements"})
+	}
+
+	statements := []models.Statement{}
+	if err := cursor.All(ctx, &statements); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot parse statements"})
+	}
+	return c.JSON(statements)
+}
+
+// GetStatementReconciliation reconciles a saved statement again, picking up
+// payments recorded since it was uploaded
+func GetStatementReconciliation(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	statement, status, err := findStatement(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report, err := reconcileStatement(ctx, *statement)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reconcile statement"})
+	}
+	return c.JSON(report)
+}
+
+// PayFromStatementLine records the payment for an unmatched statement line:
+// {"student_id": "...", "month": "2006-01"}. The student is found by the
+// sender's phone number when no ID is given, and the month defaults to the
+// month of the transaction. The amount has to cover the month's fee, late
+// fees and credits exactly.
+func PayFromStatementLine(c *fiber.Ctx) error {
+	row, err := strconv.Atoi(c.Params("row"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid row"})
+	}
+
+	var req struct {
+		StudentID string `json:"student_id"`
+		Month     string `json:"month"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	statement, status, err := findStatement(ctx, c.Params("id"))
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	report, err := reconcileStatement(ctx, *statement)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to reconcile statement"})
+	}
+	var line *ReconciledLine
+	for i := range report.Lines {
+		if report.Lines[i].Row == row {
+			line = &report.Lines[i]
+		}
+	}
+	if line == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "No such line on the statement"})
+	}
+	if line.Status != lineUnmatched {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Line is already paired with receipt " + line.ReceiptNo})
+	}
+
+	month := req.Month
+	if month == "" {
+		month = line.Time.In(centreLocation()).Format(monthLayout)
+	}
+	if _, _, err := monthBounds(month); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "month must be YYYY-MM"})
+	}
+
+	matcher, err := newStudentMatcher(ctx, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+	student, reason := matcher.match(req.StudentID, line.SenderNumber, "")
+	if student == nil {
+		return c.Status(400).JSON(fiber.Map{"error": reason + ", give a student_id"})
+	}
+
+	lines, err := monthPaymentLines(ctx, *student, month)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+
+	// Enrolments can be paid one at a time, so the month is only paid once
+	// no fee line is left. A fee without an enrolment can only be paid whole.
+	unpaid := 0
+	for _, l := range lines {
+		if l.Kind != models.LineFee {
+			continue
+		}
+		if l.EnrolmentID == "" {
+			paid, err := database.DB.Collection("payments").CountDocuments(ctx, bson.M{
+				"student_id": student.ID.Hex(),
+				"months":     month,
+				"void":       false,
+			})
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Cannot check earlier payments"})
+			}
+			if paid > 0 {
+				continue
+			}
+		}
+		unpaid++
+	}
+	if unpaid == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": student.Name + " has already paid for " + month})
+	}
+
+	due := 0.0
+	for _, l := range lines {
+		due += l.Amount
+	}
+	if math.Abs(due-line.Amount) >= 0.01 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("%s owes %.2f for %s but the statement line is %.2f", student.Name, due, month, line.Amount),
+			"lines": lines,
+		})
+	}
+
+	// The money came in when the statement says, so it belongs to that day
+	locked, err := dayLocked(ctx, c, line.Time)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check day close"})
+	}
+	if locked {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": line.Time.In(centreLocation()).Format(dateLayout) + " is closed, ask an admin"})
+	}
+
+	method := PaymentMethod{Method: statement.Method, TransactionID: line.TransactionID, SenderNumber: line.SenderNumber}
+	if err := method.normalize(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	payment := newPayment(*student, []string{month}, lines, method, auth.CurrentUser(c))
+	if !line.Time.IsZero() {
+		payment.PaidAt = line.Time
+	}
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if err := savePayment(sc, payment); err != nil {
+			return err
+		}
+		return markMonthPaid(sc, *student, month)
+	})
+	if errors.Is(err, errDuplicateTransaction) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This transaction ID was already used for another payment"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to record payment"})
+	}
+
+	notifyPayment(*student, payment.ReceiptNo)
+
+	return c.Status(fiber.StatusCreated).JSON(payment)
+}
+
+func findStatement(ctx context.Context, id string) (*models.Statement, int, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, 400, errors.New("Invalid ID")
+	}
+	var statement models.Statement
+	if err := database.DB.Collection("statements").FindOne(ctx, bson.M{"_id": objID}).Decode(&statement); err != nil {
+		return nil, 404, errors.New("Statement not found")
+	}
+	return &statement, 200, nil
+}
+
+// reconcileStatement pairs each statement line with a payment of the same
+// method, first by transaction ID and then, for typos in the ID, by amount
+// and sender among payments made around the statement's dates. Payments in
+// that window left without a line are listed as unmatched.
+func reconcileStatement(ctx context.Context, statement models.Statement) (*Reconciliation, error) {
+	start, err := time.ParseInLocation(dateLayout, statement.From, centreLocation())
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.ParseInLocation(dateLayout, statement.To, centreLocation())
+	if err != nil {
+		return nil, err
+	}
+	// A day either side for payments recorded before or after the money arrived
+	start, end = start.AddDate(0, 0, -1), end.AddDate(0, 0, 2)
+
+	trxIDs := []string{}
+	for _, l := range statement.Lines {
+		trxIDs = append(trxIDs, l.TransactionID)
+	}
+
+	var payments []models.Payment
+	err = findAll(ctx, "payments", bson.M{
+		"method": statement.Method,
+		"void":   false,
+		"$or": bson.A{
+			bson.M{"transaction_id": bson.M{"$in": trxIDs}},
+			bson.M{"paid_at": bson.M{"$gte": start, "$lt": end}},
+		},
+	}, &payments)
+	if err != nil {
+		return nil, err
+	}
+
+	byTrxID := map[string]int{}
+	for i, p := range payments {
+		if p.TransactionID != "" {
+			byTrxID[p.TransactionID] = i
+		}
+	}
+	used := make([]bool, len(payments))
+
+	report := &Reconciliation{Statement: statement, Lines: []ReconciledLine{}, UnmatchedLines: []ReconciledLine{}, UnmatchedPayments: []models.Payment{}}
+	report.Statement.Lines = nil
+
+	pair := func(r *ReconciledLine, i int) {
+		used[i] = true
+		p := payments[i]
+		r.PaymentID, r.ReceiptNo = p.ID.Hex(), p.ReceiptNo
+		if p.TransactionID != r.TransactionID {
+			r.Problems = append(r.Problems, "transaction ID on the receipt is "+p.TransactionID)
+		}
+		if math.Abs(p.Amount-r.Amount) >= 0.01 {
+			r.Problems = append(r.Problems, fmt.Sprintf("receipt amount is %.2f", p.Amount))
+		}
+		if r.SenderNumber != "" && p.SenderNumber != "" && r.SenderNumber != p.SenderNumber {
+			r.Problems = append(r.Problems, "sender on the receipt is "+p.SenderNumber)
+		}
+		r.Status = lineMatched
+		if len(r.Problems) > 0 {
+			r.Status = lineMismatch
+		}
+	}
+
+	lines := make([]ReconciledLine, len(statement.Lines))
+	for n, l := range statement.Lines {
+		lines[n] = ReconciledLine{StatementLine: l, Status: lineUnmatched}
+		if i, ok := byTrxID[l.TransactionID]; ok {
+			pair(&lines[n], i)
+		}
+	}
+	// Second pass, so an exact ID match always wins over a guess
+	for n := range lines {
+		r := &lines[n]
+		if r.Status != lineUnmatched || r.SenderNumber == "" {
+			continue
+		}
+		for i, p := range payments {
+			if !used[i] && p.SenderNumber == r.SenderNumber && math.Abs(p.Amount-r.Amount) < 0.01 {
+				pair(r, i)
+				break
+			}
+		}
+	}
+
+	for _, r := range lines {
+		report.StatementTotal += r.Amount
+		switch r.Status {
+		case lineMatched:
+			report.Matched++
+		case lineMismatch:
+			report.Mismatched++
+		default:
+			report.UnmatchedLines = append(report.UnmatchedLines, r)
+		}
+	}
+	report.Lines = lines
+
+	for i, p := range payments {
+		report.LedgerTotal += p.Amount
+		if !used[i] {
+			report.UnmatchedPayments = append(report.UnmatchedPayments, p)
+		}
+	}
+	report.StatementTotal = round2(report.StatementTotal)
+	report.LedgerTotal = round2(report.LedgerTotal)
+	return report, nil
+}
+
+// parseStatementAmount reads amounts like "1,500.00", "Tk 1500" or "৳1,500"
+func parseStatementAmount(v string) (float64, error) {
+	v = strings.NewReplacer(",", "", "৳", "", "Tk", "", "BDT", "", " ", "").Replace(v)
+	if v == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q is not a number", v)
+	}
+	return amount, nil
+}
+
+func parseStatementTime(v string) (time.Time, error) {
+	for _, layout := range statementTimeLayouts {
+		if t, err := time.ParseInLocation(layout, v, centreLocation()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot read date %q", v)
+}
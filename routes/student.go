@@ -2,15 +2,18 @@ package routes
 
 import (
 	"context"
+	"errors"
     "strconv"
+    "strings"
     "time"
-    "log"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/dishan1223/cms/auth"
 	"github.com/dishan1223/cms/database"
 	"github.com/dishan1223/cms/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // AddStudent handles POST requests to add a new student
@@ -25,11 +28,34 @@ func AddStudent(c *fiber.Ctx) error {
 	}
 
 	student.ID = primitive.NewObjectID()
+	// Discounts need an approver, so they are given through GiveDiscount
+	student.Discounts = nil
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := studentCollection.InsertOne(ctx, student)
+	// Study days must be one of the managed patterns
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch study days"})
+	}
+	if !patterns.Valid(student.StudyDays) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown study days " + student.StudyDays})
+	}
+	student.StudyDays = strings.ToLower(student.StudyDays)
+
+	// The batch given with the student is their first enrolment
+	err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+		if _, err := studentCollection.InsertOne(sc, student); err != nil {
+			return err
+		}
+		if student.BatchID == "" && student.BatchTime == "" && student.Subject == "" {
+			return nil
+		}
+		e := legacyEnrolment(*student, time.Now().Format(dateLayout))
+		student.Enrolments = []models.Enrolment{e}
+		return insertEnrolment(sc, e)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot insert student"})
 	}
@@ -60,6 +86,14 @@ func GetStudentByID(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
 	}
 
+	// Show the effective fee and why it differs from the batch fee
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+	}
+	student.Fee = fees.fee(student, time.Now().Format(monthLayout))
+	student.Enrolments = fees.enrolments[student.ID.Hex()]
+
 	return c.JSON(student)
 }
 
@@ -82,6 +116,16 @@ func GetStudents(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot parse students"})
 	}
 
+	fees, err := newFeeCalculator(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot work out fees"})
+	}
+	month := time.Now().Format(monthLayout)
+	for i := range students {
+		students[i].Fee = fees.fee(students[i], month)
+		students[i].Enrolments = fees.enrolments[students[i].ID.Hex()]
+	}
+
 	return c.JSON(students)
 }
 
@@ -105,16 +149,35 @@ func DeleteStudent(c *fiber.Ctx) error {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
-    // Delete the student from the collection
-    res, err := studentCollection.DeleteOne(ctx, bson.M{"_id": studentID})
+    // Delete the student and take them out of their batches too
+    err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+        res, err := studentCollection.DeleteOne(sc, bson.M{"_id": studentID})
+        if err != nil {
+            return err
+        }
+        if res.DeletedCount == 0 {
+            return mongo.ErrNoDocuments
+        }
+
+        enrolments, err := loadEnrolments(sc, bson.M{"student_id": idParam, "status": models.EnrolmentActive})
+        if err != nil {
+            return err
+        }
+        for _, e := range enrolments {
+            if err := countInBatch(sc, e.BatchID, -1); err != nil {
+                return err
+            }
+        }
+        _, err = database.DB.Collection("enrolments").DeleteMany(sc, bson.M{"student_id": idParam})
+        return err
+    })
+    if errors.Is(err, mongo.ErrNoDocuments) {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
+    }
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete student"})
     }
 
-    if res.DeletedCount == 0 {
-        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
-    }
-
     // Return success message
     return c.JSON(fiber.Map{"message": "Student deleted successfully"})
 }
@@ -147,6 +210,10 @@ func UpdateStudent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse students"})
 	}
 
+	// Discounts are changed through GiveDiscount and RemoveDiscount
+	delete(updateData, "discounts")
+	delete(updateData, "fee")
+
 	// Remove empty fields so we don't overwrite existing data
 	for key, value := range updateData {
 		strVal, ok := value.(string)
@@ -167,8 +234,8 @@ func UpdateStudent(c *fiber.Ctx) error {
 			}
 		}
 
-		// Convert payment_status to bool
-		if key == "payment_status" {
+		// Convert payment_status and no_absence_alerts to bool
+		if key == "payment_status" || key == "no_absence_alerts" {
 			switch v := value.(type) {
 			case string:
 				if v == "true" {
@@ -194,6 +261,40 @@ func UpdateStudent(c *fiber.Ctx) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Study days must be one of the managed patterns
+	if code, ok := updateData["study_days"].(string); ok {
+		patterns, err := loadStudyDays(ctx)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Cannot fetch study days"})
+		}
+		if !patterns.Valid(code) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Unknown study days " + code})
+		}
+		updateData["study_days"] = strings.ToLower(code)
+	}
+
+	// Moving a student to another batch is a transfer, which keeps where
+	// they were, so the batch can't be changed here
+	current, status, err := findStudent(ctx, studentID.Hex())
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	if v, ok := updateData["batch_id"]; ok && v != current.BatchID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Transfer the student to change their batch"})
+	}
+	if v, ok := updateData["batch_time"]; ok && v != current.BatchTime {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Transfer the student to change their batch"})
+	}
+
+	// Class and subject mirror the first enrolment, so a correction made
+	// here is made there too
+	enrolmentUpdate := bson.M{}
+	for _, key := range []string{"class", "subject"} {
+		if v, ok := updateData[key]; ok {
+			enrolmentUpdate[key] = v
+		}
+	}
+
 	// Update the student in MongoDB
 	update := bson.M{"$set": updateData}
 	res, err := studentCollection.UpdateByID(ctx, studentID, update)
@@ -205,6 +306,12 @@ func UpdateStudent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Student not found"})
 	}
 
+	if len(enrolmentUpdate) > 0 {
+		if err := correctFirstEnrolment(ctx, studentID, enrolmentUpdate); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update enrolment"})
+		}
+	}
+
 	return c.JSON(fiber.Map{"message": "Student updated successfully"})
 }
 
@@ -226,14 +333,64 @@ func TogglePaymentStatus(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Student not found"})
 	}
 
+	// How the student paid, e.g. {"method":"bkash","transaction_id":"...","sender_number":"..."};
+	// no body means cash
+	var method PaymentMethod
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&method); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+		}
+	}
+	if err := method.normalize(); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	currentMonth := time.Now().Format("January")
+	ledgerMonth := time.Now().Format(monthLayout)
+
+	// The ledger write for the toggle, done with the student's below
+	var ledger func(sc mongo.SessionContext) error
+	var payment *models.Payment
 
 	// Toggle payment
 	if student.PaymentStatus {
 		// Paid → Unpaid
 		student.PaymentStatus = false
+
+		// Take the money back out of the payments ledger, every payment of
+		// the month, unless a day one was paid has been closed
+		payments, err := monthPayments(context.Background(), objID.Hex(), ledgerMonth)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch payment"})
+		}
+		for _, paid := range payments {
+			locked, err := dayLocked(context.Background(), c, paid.PaidAt)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Cannot check day close"})
+			}
+			if locked {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The day " + paid.ReceiptNo + " was paid is closed, ask an admin"})
+			}
+			refunded, err := hasRefunds(context.Background(), paid.ID.Hex())
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch refunds"})
+			}
+			if refunded {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Payment " + paid.ReceiptNo + " has refunds, it can't be voided"})
+			}
+		}
+		ledger = func(sc mongo.SessionContext) error {
+			return voidMonthPayments(sc, payments)
+		}
 	} else {
 		// Unpaid → Paid
+		locked, err := dayLocked(context.Background(), c, time.Now())
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot check day close"})
+		}
+		if locked {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Today is closed, ask an admin"})
+		}
 		student.PaymentStatus = true
 
 		// Add current month to PaidMonths if not already present
@@ -257,24 +414,48 @@ func TogglePaymentStatus(c *fiber.Ctx) error {
 		}
 		student.DueMonths = updatedDue
 
-		// Log the notification message to console
-		notifyPayment(student)
+		// Keep the payment in the ledger used by payroll and reports,
+		// charging the effective fee after discounts and any late fee
+		lines, err := monthPaymentLines(context.Background(), student, ledgerMonth)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Cannot work out fee"})
+		}
+
+		payment = newPayment(student, []string{ledgerMonth}, lines, method, auth.CurrentUser(c))
+		ledger = func(sc mongo.SessionContext) error {
+			return savePayment(sc, payment)
+		}
 	}
 
-	// Update the student in MongoDB
-	_, err = collection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": objID},
-		bson.M{
-			"$set": bson.M{
-				"payment_status": student.PaymentStatus,
-				"paid_months":    student.PaidMonths,
-				"due_months":     student.DueMonths,
+	// Update the ledger and the student in MongoDB together, so a failed
+	// write can be retried without paying twice
+	err = withTransaction(context.Background(), func(sc mongo.SessionContext) error {
+		if err := ledger(sc); err != nil {
+			return err
+		}
+		_, err := collection.UpdateOne(
+			sc,
+			bson.M{"_id": objID},
+			bson.M{
+				"$set": bson.M{
+					"payment_status": student.PaymentStatus,
+					"paid_months":    student.PaidMonths,
+					"due_months":     student.DueMonths,
+				},
 			},
-		},
-	)
+		)
+		return err
+	})
+	if errors.Is(err, errDuplicateTransaction) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This " + method.Method + " transaction ID was already used for another payment"})
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to update student"})
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update payment"})
+	}
+
+	// Log the notification message to console
+	if payment != nil {
+		notifyPayment(student, payment.ReceiptNo)
 	}
 
 	return c.JSON(student)
@@ -282,18 +463,19 @@ func TogglePaymentStatus(c *fiber.Ctx) error {
 
 
 
-// Just log the notification message like an SMS
-func notifyPayment(student models.Student) {
+// Send the payment confirmation to the student's phone
+func notifyPayment(student models.Student, receiptNo string) {
     date :=  time.Now().Format("02-January-2006")
-	message := "\n📢 Payment received for student: " +
+	message := "Payment received for student: " +
 		student.Name +
+        "\n | Receipt: " + receiptNo +
         "\n | Date: " + date +
         "\n | Class: " + student.Class +
 		"\n | Subject: " + student.Subject +
 		"\n | Batch: " + student.BatchTime +
 		"\n | Phone: " + student.PhoneNumber
 
-	log.Println(message)
+	sendSMS(student.PhoneNumber, message)
 }
 
 // reset students' due months
@@ -0,0 +1,359 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Same columns ExportStudents writes, plus an optional Batch column
+var studentHeaderAliases = map[string][]string{
+	"name":           {"Name", "Student Name"},
+	"phone_number":   {"Phone Number", "Phone", "Mobile"},
+	"class":          {"Class"},
+	"subject":        {"Subject"},
+	"payment_status": {"Payment Status"},
+	"payment_amount": {"Payment Amount", "Fee"},
+	"study_days":     {"Study Days", "Days"},
+	"batch":          {"Batch", "Batch Name", "Batch Time"},
+}
+
+// StudentImportRow is the dry-run diff and the final report of one row
+type StudentImportRow struct {
+	Sheet    string          `json:"sheet"`
+	Row      int             `json:"row"`
+	Action   string          `json:"action"` // create, created, enrol, enrolled, duplicate, error
+	Student  *models.Student `json:"student,omitempty"`
+	Errors   []string        `json:"errors,omitempty"`
+	Warnings []string        `json:"warnings,omitempty"`
+}
+
+// ImportStudents adds students from an .xlsx/.csv file laid out like the
+// ExportStudents report. Each Excel sheet is a batch (the sheet name), unless
+// a Batch column says otherwise. A student already added, from the file or
+// before, who turns up in another batch is enrolled there instead of being
+// added twice. Without commit=true nothing is written and the response is a
+// dry run; with it every new student and enrolment is saved in one
+// transaction, or none are.
+func ImportStudents(c *fiber.Ctx) error {
+	mapping := map[string]string{}
+	if m := c.FormValue("mapping"); m != "" {
+		if err := json.Unmarshal([]byte(m), &mapping); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "mapping must be a JSON object"})
+		}
+		for h, field := range mapping {
+			if _, ok := studentHeaderAliases[field]; !ok {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("unknown field %q for column %q", field, h)})
+			}
+		}
+	}
+
+	sheets, err := readUploadedSheets(c, "file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	batches, err := loadBatchLookup(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch batches"})
+	}
+
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch study days"})
+	}
+
+	existing, err := newStudentMatcher(ctx, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch students"})
+	}
+	enrolments, err := loadEnrolments(ctx, bson.M{"status": models.EnrolmentActive})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch enrolments"})
+	}
+	enrolled := map[string]bool{} // student ID|batch ID
+	for _, e := range enrolments {
+		enrolled[e.StudentID+"|"+e.BatchID] = true
+	}
+
+	report := []StudentImportRow{}
+	inFile := map[string]int{}
+	firstRow := map[string]int{} // key -> index in report of the row adding the student
+	enrolIn := map[int]int{}     // index in report -> index of the row adding the student
+	toCreate, toEnrol, duplicates, invalid := 0, 0, 0, 0
+
+	for _, sheet := range sheets {
+		if len(sheet.Rows) < 2 {
+			continue
+		}
+		index := headerIndex(sheet.Rows[0], mapping, studentHeaderAliases)
+		if _, ok := index["name"]; !ok {
+			continue
+		}
+
+		for i, row := range sheet.Rows[1:] {
+			if blankRow(row) {
+				continue
+			}
+
+			r := parseStudentRow(row, index, sheet.Name, batches, patterns)
+			r.Sheet = sheet.Name
+			r.Row = i + 2
+
+			key := normalizePhone(r.Student.PhoneNumber) + "|" + strings.ToLower(r.Student.Name)
+			if len(r.Errors) == 0 {
+				if prev, ok := inFile[key+"|"+r.Student.BatchID]; ok {
+					r.Errors = append(r.Errors, fmt.Sprintf("repeats row %d", prev))
+				} else {
+					inFile[key+"|"+r.Student.BatchID] = r.Row
+				}
+			}
+
+			first, seen := firstRow[key]
+			switch {
+			case len(r.Errors) > 0:
+				r.Action = "error"
+				invalid++
+			case seen && r.Student.BatchID == "":
+				r.Action = "error"
+				r.Errors = append(r.Errors, fmt.Sprintf("repeats row %d", report[first].Row))
+				invalid++
+			case seen:
+				r.Action = "enrol"
+				r.Warnings = append(r.Warnings, fmt.Sprintf("enrolled in this batch as the student of %s row %d", report[first].Sheet, report[first].Row))
+				enrolIn[len(report)] = first
+				toEnrol++
+			case isDuplicateStudent(existing, &r):
+				s := existingStudent(existing, r.Student)
+				if r.Student.BatchID != "" && !enrolled[s.ID.Hex()+"|"+r.Student.BatchID] {
+					r.Action = "enrol"
+					r.Student.ID = s.ID
+					enrolled[s.ID.Hex()+"|"+r.Student.BatchID] = true
+					toEnrol++
+				} else {
+					r.Action = "duplicate"
+					duplicates++
+				}
+			default:
+				r.Action = "create"
+				firstRow[key] = len(report)
+				toCreate++
+			}
+			report = append(report, r)
+		}
+	}
+
+	if len(report) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "no student rows found; is there a Name column?"})
+	}
+
+	response := fiber.Map{
+		"rows":       report,
+		"create":     toCreate,
+		"enrol":      toEnrol,
+		"duplicates": duplicates,
+		"invalid":    invalid,
+		"committed":  false,
+	}
+
+	if c.FormValue("commit") != "true" {
+		return c.JSON(response)
+	}
+
+	if invalid > 0 {
+		response["error"] = "Fix the invalid rows before committing"
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(response)
+	}
+
+	var docs []interface{}
+	var newEnrolments []models.Enrolment
+	today := time.Now().Format(dateLayout)
+	for i := range report {
+		if report[i].Action == "create" {
+			report[i].Student.ID = primitive.NewObjectID()
+			docs = append(docs, report[i].Student)
+			if report[i].Student.BatchID != "" || report[i].Student.Subject != "" {
+				newEnrolments = append(newEnrolments, legacyEnrolment(*report[i].Student, today))
+			}
+		}
+	}
+	for i := range report {
+		if report[i].Action != "enrol" {
+			continue
+		}
+		if first, ok := enrolIn[i]; ok {
+			report[i].Student.ID = report[first].Student.ID
+		}
+		// The row's own fee, as the student's payment_amount is another batch's
+		e := legacyEnrolment(*report[i].Student, today)
+		e.Fee = report[i].Student.PaymentAmount
+		newEnrolments = append(newEnrolments, e)
+	}
+
+	if len(docs) > 0 || len(newEnrolments) > 0 {
+		err = withTransaction(ctx, func(sc mongo.SessionContext) error {
+			if len(docs) > 0 {
+				if _, err := database.DB.Collection("students").InsertMany(sc, docs); err != nil {
+					return err
+				}
+			}
+			for _, e := range newEnrolments {
+				if err := insertEnrolment(sc, e); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Import failed, no students were added"})
+		}
+	}
+
+	for i := range report {
+		switch report[i].Action {
+		case "create":
+			report[i].Action = "created"
+		case "enrol":
+			report[i].Action = "enrolled"
+		}
+	}
+	response["committed"] = true
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// parseStudentRow validates one row and builds the student it describes
+func parseStudentRow(row []string, index map[string]int, sheetName string, batches map[string]models.Batch, patterns studyDays) StudentImportRow {
+	s := &models.Student{
+		Name:        cell(row, index, "name"),
+		PhoneNumber: cell(row, index, "phone_number"),
+		Class:       cell(row, index, "class"),
+		Subject:     cell(row, index, "subject"),
+	}
+	r := StudentImportRow{Student: s}
+
+	if s.Name == "" {
+		r.Errors = append(r.Errors, "name is required")
+	}
+	if len(normalizePhone(s.PhoneNumber)) != 11 {
+		r.Errors = append(r.Errors, "phone number must have 11 digits")
+	}
+
+	switch strings.ToUpper(cell(row, index, "payment_status")) {
+	case "PAID", "TRUE", "YES":
+		s.PaymentStatus = true
+	case "", "UNPAID", "FALSE", "NO":
+	default:
+		r.Errors = append(r.Errors, "payment status must be PAID or UNPAID")
+	}
+
+	if amount := cell(row, index, "payment_amount"); amount != "" {
+		f, err := strconv.ParseFloat(amount, 64)
+		if err != nil || f < 0 {
+			r.Errors = append(r.Errors, "payment amount must be a number")
+		}
+		s.PaymentAmount = f
+	}
+
+	if days := cell(row, index, "study_days"); days != "" {
+		code, ok := patterns.Code(days)
+		if !ok {
+			r.Errors = append(r.Errors, fmt.Sprintf("unknown study days %q", days))
+		}
+		s.StudyDays = code
+	}
+
+	batch := cell(row, index, "batch")
+	if batch == "" {
+		batch = sheetName
+	}
+	s.BatchTime = batch
+	if b, ok := batches[strings.ToLower(batch)]; ok {
+		s.BatchID = b.ID.Hex()
+		if s.Class == "" {
+			s.Class = b.Class
+		}
+		if s.Subject == "" {
+			s.Subject = b.Subject
+		}
+		if s.PaymentAmount == 0 {
+			s.PaymentAmount = b.Payment_amount
+		}
+	} else if _, hasColumn := index["batch"]; hasColumn {
+		r.Errors = append(r.Errors, fmt.Sprintf("unknown batch %q", batch))
+	} else {
+		r.Warnings = append(r.Warnings, fmt.Sprintf("sheet %q is not a known batch, batch_id left empty", batch))
+	}
+
+	return r
+}
+
+// A student already exists when both phone number and name match.
+// Siblings sharing a number are let through with a warning.
+func isDuplicateStudent(existing *studentMatcher, r *StudentImportRow) bool {
+	for _, s := range existing.byPhone[normalizePhone(r.Student.PhoneNumber)] {
+		if strings.EqualFold(strings.TrimSpace(s.Name), r.Student.Name) {
+			r.Warnings = append(r.Warnings, "already exists as "+s.ID.Hex())
+			return true
+		}
+	}
+	if others := existing.byPhone[normalizePhone(r.Student.PhoneNumber)]; len(others) > 0 {
+		r.Warnings = append(r.Warnings, "phone number is also used by "+others[0].Name)
+	}
+	return false
+}
+
+// existingStudent is the student isDuplicateStudent matched
+func existingStudent(existing *studentMatcher, s *models.Student) *models.Student {
+	for _, other := range existing.byPhone[normalizePhone(s.PhoneNumber)] {
+		if strings.EqualFold(strings.TrimSpace(other.Name), s.Name) {
+			return other
+		}
+	}
+	return nil
+}
+
+// loadBatchLookup indexes batches by lowercase name and time
+func loadBatchLookup(ctx context.Context) (map[string]models.Batch, error) {
+	batches, err := allBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := make(map[string]models.Batch)
+	for _, b := range batches {
+		if b.Time != "" {
+			lookup[strings.ToLower(b.Time)] = b
+		}
+		if b.BatchName != "" {
+			lookup[strings.ToLower(b.BatchName)] = b
+		}
+	}
+	return lookup, nil
+}
+
+// withTransaction runs fn in a MongoDB transaction
+func withTransaction(ctx context.Context, fn func(sc mongo.SessionContext) error) error {
+	session, err := database.DB.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -0,0 +1,294 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dishan1223/cms/database"
+	"github.com/dishan1223/cms/models"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Patterns the centre has always used, stored on first use
+var defaultStudyDays = []models.StudyDayPattern{
+	{Code: "smw", Label: "Saturday, Monday, Wednesday", Weekdays: []string{"Saturday", "Monday", "Wednesday"}},
+	{Code: "stt", Label: "Sunday, Tuesday, Thursday", Weekdays: []string{"Sunday", "Tuesday", "Thursday"}},
+	{Code: "regular", Label: "Regular", Weekdays: []string{}},
+}
+
+var studyDayCodeFormat = regexp.MustCompile(`^[a-z0-9_-]{1,20}$`)
+
+// studyDays is the set of patterns loaded for one request
+type studyDays map[string]models.StudyDayPattern
+
+// GetStudyDays lists all study-day patterns
+func GetStudyDays(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	patterns, err := loadStudyDayList(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch study days"})
+	}
+	return c.JSON(patterns)
+}
+
+// AddStudyDays creates a pattern, e.g. {"code":"ff","label":"Friday","weekdays":["Friday"]}
+func AddStudyDays(c *fiber.Ctx) error {
+	var pattern models.StudyDayPattern
+	if err := c.BodyParser(&pattern); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if err := normalizeStudyDays(&pattern); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	patterns, err := loadStudyDays(ctx)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch study days"})
+	}
+	if _, exists := patterns[pattern.Code]; exists {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Code already exists"})
+	}
+
+	pattern.ID = primitive.NewObjectID()
+	_, err = database.DB.Collection("study_days").InsertOne(ctx, pattern)
+	if mongo.IsDuplicateKeyError(err) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Code already exists"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot insert study days"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(pattern)
+}
+
+// UpdateStudyDays changes the label or weekdays of a pattern; the code stays
+func UpdateStudyDays(c *fiber.Ctx) error {
+	code := strings.ToLower(c.Params("code"))
+
+	var pattern models.StudyDayPattern
+	if err := c.BodyParser(&pattern); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	pattern.Code = code
+	if err := normalizeStudyDays(&pattern); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// make sure the defaults exist before editing one of them
+	if _, err := loadStudyDays(ctx); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot fetch study days"})
+	}
+
+	res, err := database.DB.Collection("study_days").UpdateOne(ctx, bson.M{"code": code}, bson.M{"$set": bson.M{
+		"label":    pattern.Label,
+		"weekdays": pattern.Weekdays,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update study days"})
+	}
+	if res.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Study days not found"})
+	}
+
+	return c.JSON(pattern)
+}
+
+// DeleteStudyDays removes a pattern no student uses any more
+func DeleteStudyDays(c *fiber.Ctx) error {
+	code := strings.ToLower(c.Params("code"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	inUse, err := database.DB.Collection("students").CountDocuments(ctx, bson.M{"study_days": code})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Cannot check students"})
+	}
+	if inUse > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("%d students still use %s", inUse, code)})
+	}
+
+	res, err := database.DB.Collection("study_days").DeleteOne(ctx, bson.M{"code": code})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete study days"})
+	}
+	if res.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Study days not found"})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Study days deleted successfully"})
+}
+
+// loadStudyDays returns the patterns by code, storing the defaults the
+// first time
+func loadStudyDays(ctx context.Context) (studyDays, error) {
+	list, err := loadStudyDayList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make(studyDays, len(list))
+	for _, p := range list {
+		patterns[p.Code] = p
+	}
+	return patterns, nil
+}
+
+func loadStudyDayList(ctx context.Context) ([]models.StudyDayPattern, error) {
+	collection := database.DB.Collection("study_days")
+
+	opts := options.Find().SetSort(bson.M{"code": 1})
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var list []models.StudyDayPattern
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list, nil
+	}
+
+	// Seed the defaults by code, so requests seeding at the same time don't
+	// add them twice
+	for _, p := range defaultStudyDays {
+		p.ID = primitive.NewObjectID()
+		_, err := collection.UpdateOne(ctx,
+			bson.M{"code": p.Code},
+			bson.M{"$setOnInsert": p},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+	}
+	cursor, err = collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// normalizeStudyDays validates a pattern and puts its weekdays in week order
+func normalizeStudyDays(p *models.StudyDayPattern) error {
+	p.Code = strings.ToLower(strings.TrimSpace(p.Code))
+	if !studyDayCodeFormat.MatchString(p.Code) {
+		return fmt.Errorf("code must be 1-20 lowercase letters, digits, - or _")
+	}
+
+	seen := make(map[time.Weekday]bool)
+	for _, d := range p.Weekdays {
+		wd, ok := parseWeekday(d)
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", d)
+		}
+		seen[wd] = true
+	}
+
+	p.Weekdays = []string{}
+	for _, wd := range weekOrder {
+		if seen[wd] {
+			p.Weekdays = append(p.Weekdays, wd.String())
+		}
+	}
+
+	p.Label = strings.TrimSpace(p.Label)
+	if p.Label == "" {
+		p.Label = strings.Join(p.Weekdays, ", ")
+	}
+	if p.Label == "" {
+		p.Label = "Regular"
+	}
+	return nil
+}
+
+// Label turns a code into its display name; unknown codes are shown as is
+func (s studyDays) Label(code string) string {
+	if p, ok := s[strings.ToLower(code)]; ok {
+		return p.Label
+	}
+	return code
+}
+
+// Valid reports whether the code is a known pattern; empty is allowed
+func (s studyDays) Valid(code string) bool {
+	if code == "" {
+		return true
+	}
+	_, ok := s[strings.ToLower(code)]
+	return ok
+}
+
+// Attends reports whether a student on that code comes on the weekday.
+// Patterns without weekdays, and unknown codes, mean every day.
+func (s studyDays) Attends(code string, day time.Weekday) bool {
+	p, ok := s[strings.ToLower(code)]
+	if !ok || len(p.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range p.Weekdays {
+		if wd, _ := parseWeekday(d); wd == day {
+			return true
+		}
+	}
+	return false
+}
+
+// FirstDay is the position in the week of the pattern's first day, used to
+// sort students; every-day patterns sort last
+func (s studyDays) FirstDay(code string) int {
+	p, ok := s[strings.ToLower(code)]
+	if !ok || len(p.Weekdays) == 0 {
+		return len(weekOrder)
+	}
+	wd, _ := parseWeekday(p.Weekdays[0])
+	for i, d := range weekOrder {
+		if d == wd {
+			return i
+		}
+	}
+	return len(weekOrder)
+}
+
+// Code finds the pattern written as its code, its label or its list of
+// weekdays, e.g. when reading back an exported sheet
+func (s studyDays) Code(text string) (string, bool) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	if _, ok := s[text]; ok {
+		return text, true
+	}
+
+	for code, p := range s {
+		if strings.ToLower(p.Label) == text || strings.ToLower(strings.Join(p.Weekdays, ", ")) == text {
+			return code, true
+		}
+	}
+
+	// Exports made before the patterns were shared called stt this
+	if text == "saturday, tuesday, thursday" {
+		if _, ok := s["stt"]; ok {
+			return "stt", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+)
+
+// uploadedSheet is one sheet of an uploaded spreadsheet; CSV files have one
+type uploadedSheet struct {
+	Name string
+	Rows [][]string
+}
+
+// readUploadedSheets reads the .xlsx or .csv file sent in the given form field
+func readUploadedSheets(c *fiber.Ctx, field string) ([]uploadedSheet, error) {
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("file is required")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open uploaded file")
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	name := strings.TrimSuffix(fileHeader.Filename, filepath.Ext(fileHeader.Filename))
+
+	switch ext {
+	case ".csv":
+		rows, err := readCSV(file)
+		if err != nil {
+			return nil, err
+		}
+		return []uploadedSheet{{Name: name, Rows: rows}}, nil
+
+	case ".xlsx":
+		f, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read Excel file")
+		}
+		defer f.Close()
+
+		var sheets []uploadedSheet
+		for _, sheet := range f.GetSheetList() {
+			rows, err := f.GetRows(sheet)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read sheet %s", sheet)
+			}
+			sheets = append(sheets, uploadedSheet{Name: sheet, Rows: rows})
+		}
+		return sheets, nil
+
+	default:
+		return nil, fmt.Errorf("only .xlsx and .csv files are supported")
+	}
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read CSV file: %v", err)
+	}
+
+	// Strip the UTF-8 BOM Excel puts in front of CSV exports
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+// headerIndex maps each wanted field to its column. mapping takes a header
+// text to a field name; headers not in mapping are matched against aliases.
+func headerIndex(header []string, mapping map[string]string, aliases map[string][]string) map[string]int {
+	index := make(map[string]int)
+
+	normalized := make(map[string]string)
+	for h, field := range mapping {
+		normalized[normalizeHeader(h)] = field
+	}
+
+	for col, h := range header {
+		key := normalizeHeader(h)
+		if field, ok := normalized[key]; ok {
+			index[field] = col
+			continue
+		}
+		for field, names := range aliases {
+			if _, taken := index[field]; taken {
+				continue
+			}
+			for _, name := range names {
+				if normalizeHeader(name) == key {
+					index[field] = col
+				}
+			}
+		}
+	}
+
+	return index
+}
+
+func normalizeHeader(h string) string {
+	return strings.ToLower(strings.Join(strings.Fields(h), " "))
+}
+
+// cell returns the trimmed value of a column, empty if the row is short
+func cell(row []string, index map[string]int, field string) string {
+	col, ok := index[field]
+	if !ok || col >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[col])
+}
+
+// blankRow reports whether every cell of a row is empty
+func blankRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}